@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+}
+
+var batchCmd = &cobra.Command{
+	Use:   "batch [file...]",
+	Short: "Check tokens for many services at once, one service and token per line",
+	Long: "Check tokens for any configured service, read from the files given or from stdin. " +
+		"Each line is either the service name and the token separated by a tab, or a JSON " +
+		"object such as {\"service\": \"github-token\", \"token\": \"ghp_...\"}. Blank lines " +
+		"are skipped; lines that can't be parsed are reported as unknown, reason \"bad input\".",
+	Example: "  kh batch findings.tsv\n" +
+		"  jq -c '{service, token}' findings.json | kh batch --format jsonl",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// A dry run sends nothing, so mustn't create or empty --show-out
+		var (
+			out resultWriter
+			err error
+		)
+		if dryRun == "" {
+			if out, err = newResultWriter(cmd.OutOrStdout(), true); err != nil {
+				return configError(err)
+			}
+		}
+		if len(args) == 0 {
+			args = []string{"-"}
+		}
+
+		// Open every file up front, so a typo fails before anything is sent
+		var inputs []io.Reader
+		for _, arg := range args {
+			if arg == "-" {
+				inputs = append(inputs, cmd.InOrStdin())
+				continue
+			}
+			f, err := os.Open(arg)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			inputs = append(inputs, f)
+		}
+
+		checks := make(chan check)
+		readErr := make(chan error, 1)
+		go func() {
+			defer close(checks)
+			for _, r := range inputs {
+				scanner := bufio.NewScanner(r)
+				for scanner.Scan() {
+					if c, ok := parseBatchLine(scanner.Text()); ok {
+						checks <- c
+					}
+				}
+				if err := scanner.Err(); err != nil {
+					readErr <- err
+					return
+				}
+			}
+			readErr <- nil
+		}()
+
+		if dryRun != "" {
+			err = printRequests(cmd, checks, true)
+		} else {
+			err = checkAll(cmd, out, checks)
+		}
+		if err != nil {
+			return err
+		}
+		return <-readErr
+	},
+}
+
+// parseBatchLine reads a service and token from a line of batch input. Blank
+// lines are skipped; lines that can't be parsed become checks that fail with
+// the reason.
+func parseBatchLine(line string) (check, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	if strings.TrimSpace(line) == "" {
+		return check{}, false
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(line), "{") {
+		var entry struct {
+			Service string `json:"service"`
+			Token   string `json:"token"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return check{token: line, err: fmt.Errorf("invalid JSON: %w", err)}, true
+		}
+		if entry.Service == "" || entry.Token == "" {
+			return check{service: entry.Service, token: entry.Token, err: errors.New(`want both "service" and "token"`)}, true
+		}
+		return check{service: entry.Service, token: entry.Token}, true
+	}
+
+	service, token, ok := strings.Cut(line, "\t")
+	if !ok || service == "" || token == "" {
+		return check{token: line, err: errors.New("want a service and a token separated by a tab")}, true
+	}
+	return check{service: service, token: token}, true
+}
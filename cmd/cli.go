@@ -2,98 +2,311 @@ package cli
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/audibleblink/kh/pkg/keyhack"
+	"github.com/audibleblink/kh/pkg/registry"
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "kh",
 	Short: "Validate API tokens/webhooks for various services",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		keyhack.Redact = !noRedact
+		keyhack.Progress = cmd.ErrOrStderr()
+		if err := checkFailOn(); err != nil {
+			return err
+		}
+		if err := checkShow(); err != nil {
+			return err
+		}
+		if err := checkDryRun(); err != nil {
+			return err
+		}
+		return configError(keyhack.Configure(transport))
+	},
+	// Anything left for the root command is a mistyped command or service,
+	// which is a usage error like any other
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return nil
+		}
+		// As cobra words it, pointing at --help rather than printing usage
+		cmd.SilenceUsage = true
+		msg := fmt.Sprintf("unknown command %q for %q", args[0], cmd.CommandPath())
+		if suggestions := cmd.SuggestionsFor(args[0]); len(suggestions) > 0 {
+			msg += "\n\nDid you mean this?\n\t" + strings.Join(suggestions, "\n\t") + "\n"
+		}
+		return configError(fmt.Errorf("%s\nRun '%s --help' for usage.", msg, cmd.CommandPath()))
+	},
+	SuggestionsMinimumDistance: 2,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
 }
 
-// serviceCommands tracks all registered service commands
-var serviceCommands []*cobra.Command
+var (
+	// verbose reports every result on stderr, not just the unknown ones
+	verbose bool
+
+	// noRedact shows credentials in errors and dry-run output
+	noRedact bool
+)
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false,
+		"report invalid tokens and error details on stderr")
+	rootCmd.PersistentFlags().BoolVar(&noRedact, "no-redact", false,
+		"show credentials in full in errors, metadata and dry-run output")
+	rootCmd.PersistentFlags().DurationVar(&keyhack.DefaultTimeout, "timeout", keyhack.DefaultTimeout,
+		"time allowed for each request, unless the service sets its own")
+	rootCmd.PersistentFlags().IntVar(&keyhack.DefaultRetry.Retries, "retries", keyhack.DefaultRetry.Retries,
+		"times to retry a request after a timeout, dropped connection, 429, 5xx or exhausted quota")
+	rootCmd.PersistentFlags().DurationVar(&keyhack.DefaultRetry.Backoff, "backoff", keyhack.DefaultRetry.Backoff,
+		"delay before the first retry, doubled for each one after")
+	rootCmd.PersistentFlags().Float64Var(&keyhack.DefaultRetry.Jitter, "jitter", keyhack.DefaultRetry.Jitter,
+		"randomise retry delays by up to this fraction")
+}
+
+// validators holds custom validators until the configuration is loaded
+var validators = make(map[string]keyhack.ValidatorFunc)
+
+// RegisterValidator queues a custom validator for a service. Validators are
+// attached to their services when Execute runs, after the configuration has
+// been loaded, so it is safe to call from an init function.
+func RegisterValidator(serviceName string, fn keyhack.ValidatorFunc) {
+	validators[serviceName] = fn
+}
 
 // Execute runs the CLI application
 func Execute() {
-	// Add all registered service commands to the root command
-	for _, cmd := range serviceCommands {
-		rootCmd.AddCommand(cmd)
+	// Service commands are built from the configuration, so --config has to
+	// be known before cobra parses the command line
+	files, err := configFlag(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(exitConfig)
+	}
+	configFiles = files
+
+	if err := loadConfigs(os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading configuration: %s\n", err)
+		os.Exit(exitConfig)
+	}
+
+	// Attach custom validators to the loaded services
+	for name, fn := range validators {
+		if err := registry.RegisterValidator(name, fn); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+		}
 	}
 
-	// Let Cobra handle command execution and errors
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	// Add a command for every configured service
+	for _, service := range registry.Services() {
+		if builtinCommand(service.Name) {
+			fmt.Fprintf(os.Stderr, "Error loading configuration: service %q has the name of a kh command\n", service.Name)
+			os.Exit(exitConfig)
+		}
+		rootCmd.AddCommand(NewServiceCommand(service))
 	}
+
+	// Ctrl-C cancels in-flight checks so the results so far can be flushed;
+	// a second one exits straight away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// Let Cobra handle command execution and errors; the exit status
+	// follows from the results reported
+	os.Exit(exitStatus(rootCmd.ExecuteContext(ctx)))
+}
+
+// builtinCommand reports whether name is taken by one of kh's own commands,
+// which would shadow a service of the same name
+func builtinCommand(name string) bool {
+	// Cobra only adds these when the command line is executed
+	if name == "help" || name == "completion" {
+		return true
+	}
+	for _, cmd := range rootCmd.Commands() {
+		if cmd.Name() == name || cmd.HasAlias(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// configFlag picks the values of --config out of the command line, ignoring
+// every other flag
+func configFlag(args []string) ([]string, error) {
+	flags := pflag.NewFlagSet("config", pflag.ContinueOnError)
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	flags.SetOutput(io.Discard)
+	flags.Usage = func() {}
+
+	files := flags.StringArray("config", nil, "")
+	if err := flags.Parse(args); err != nil && !errors.Is(err, pflag.ErrHelp) {
+		return nil, err
+	}
+
+	return *files, nil
 }
 
 // NewServiceCommand creates a new cobra command for a service
-func NewServiceCommand(name, desc string) *cobra.Command {
-	usage := strings.Join([]string{name, desc}, " ")
+func NewServiceCommand(service *keyhack.KeyHack) *cobra.Command {
+	name := service.Name
+
+	placeholder := credentialShape(service)
+
+	desc := service.Description
+	if desc == "" {
+		desc = fmt.Sprintf("Checks a token against %s", name)
+	}
+
+	var tokens []string
+
+	usage := strings.Join([]string{name, placeholder}, " ")
 	cmd := &cobra.Command{
-		DisableFlagsInUseLine: true,
-		DisableFlagParsing:    true,
-		Use:                   usage,
-		Short:                 desc,
-		Args:                  cobra.MinimumNArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
+		Use:          usage,
+		Short:        desc,
+		SilenceUsage: true,
+		Example: strings.Join([]string{
+			fmt.Sprintf("  kh %s %s", name, placeholder),
+			fmt.Sprintf("  kh %s - < tokens.txt", name),
+			fmt.Sprintf("  kh %s -- -token-starting-with-a-dash", name),
+		}, "\n"),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && len(tokens) == 0 {
+				return configError(fmt.Errorf("requires a token, - to read tokens from stdin, or --token"))
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// A dry run sends nothing, so mustn't create or empty --show-out
 			var (
-				ok  bool
+				out resultWriter
 				err error
 			)
-
-			// accept multiple lines through stdin
-			if args[0] == "-" {
-				scanner := bufio.NewScanner(os.Stdin)
-				for scanner.Scan() {
-					token := scanner.Text()
-					ok, err = keyhack.Check(name, token)
-					if err != nil {
-						cmd.PrintErr(err)
-						continue
-					}
-					if ok {
-						cmd.Println(token)
-					}
+			if dryRun == "" {
+				if out, err = newResultWriter(cmd.OutOrStdout(), false); err != nil {
+					return configError(err)
 				}
-				return
 			}
 
-			// allow multiple args so commands like xargs also work
-			if len(args) > 1 {
-				for _, token := range args {
-					ok, err = keyhack.Check(name, token)
-					if err != nil {
-						cmd.PrintErr(err)
-						continue
-					}
-					if ok {
-						cmd.Println(token)
-					}
-				}
-				return
-			}
+			// --token values are taken literally, even if they look like flags
+			inputs := append(args, tokens...)
 
-			token := args[0]
-			ok, err = keyhack.Check(name, token)
-			if err != nil {
-				cmd.PrintErr(err)
-				os.Exit(1)
+			checks, readErr := readInputs(cmd, check{service: name}, args, inputs)
+
+			if dryRun != "" {
+				err = printRequests(cmd, checks, false)
+			} else {
+				err = checkAll(cmd, out, checks)
 			}
-			if ok {
-				cmd.Println(token)
-				return
+			if err != nil {
+				return err
 			}
-			os.Exit(1)
+			return <-readErr
 		},
 	}
 
-	// Register the command in the registry
-	serviceCommands = append(serviceCommands, cmd)
+	cmd.Flags().StringArrayVarP(&tokens, "token", "t", nil,
+		"token to check, taken literally even if it starts with - (repeatable)")
 
 	return cmd
 }
+
+// readInputs feeds a copy of base for every token given on the command line
+// to the returned channel, reading the - arguments line by line from stdin.
+// Once every check has been taken, the error channel yields the error that
+// cut stdin short, if any.
+func readInputs(cmd *cobra.Command, base check, args, inputs []string) (<-chan check, <-chan error) {
+	checks := make(chan check)
+	readErr := make(chan error, 1)
+	send := func(token string) {
+		c := base
+		c.token = token
+		checks <- c
+	}
+
+	go func() {
+		defer close(checks)
+
+		for i, token := range inputs {
+			// accept multiple lines through stdin
+			if token == "-" && i < len(args) {
+				scanner := bufio.NewScanner(cmd.InOrStdin())
+				for scanner.Scan() {
+					send(scanner.Text())
+				}
+				if err := scanner.Err(); err != nil {
+					readErr <- fmt.Errorf("reading stdin: %w", err)
+					return
+				}
+				continue
+			}
+
+			// allow multiple args so commands like xargs also work
+			send(token)
+		}
+		readErr <- nil
+	}()
+	return checks, readErr
+}
+
+// checkAll runs the checks with the worker pool, reports every result and
+// flushes out
+func checkAll(cmd *cobra.Command, out resultWriter, checks <-chan check) error {
+	var err error
+	runChecks(cmd.Context(), checks, concurrency, ordered, func(result keyhack.Result) {
+		if err == nil {
+			err = report(cmd, out, result)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return interrupted(cmd.Context())
+}
+
+// report writes the results --show selects, valid ones by default, to out.
+// Unknown results that aren't shown go to stderr as tab-separated status,
+// reason and token, so they can be re-queued; with --verbose, invalid results
+// and error details are reported too.
+func report(cmd *cobra.Command, out resultWriter, result keyhack.Result) error {
+	tally[result.Status]++
+
+	switch {
+	case shown[result.Status]:
+		return out.Write(result)
+	case result.Status == keyhack.StatusUnknown, verbose:
+		fmt.Fprintf(cmd.ErrOrStderr(), "%s\t%s\t%s\n", result.Status, result.Reason, result.Token)
+		if verbose && result.Err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "\t%s\n", result.Err)
+		}
+	}
+	return nil
+}
+
+// interrupted returns an error if the run was cut short by Ctrl-C
+func interrupted(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return errors.New("interrupted, remaining tokens were not checked")
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/audibleblink/kh/pkg/registry"
+)
+
+// projectConfig is the project-local config file, looked up in the working
+// directory
+const projectConfig = ".kh.yml"
+
+var (
+	// configFiles are the files passed with --config
+	configFiles []string
+
+	// configLayers records every config file that was loaded, lowest
+	// precedence first
+	configLayers = []string{registry.EmbeddedSource}
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringArrayVar(&configFiles, "config", nil,
+		"additional service definitions, layered over all others (repeatable)")
+
+	showCmd.Flags().Bool("effective", false, "print the merged service definitions")
+	configCmd.AddCommand(showCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the service configuration",
+}
+
+var showCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the config files in use, or the merged result with --effective",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		effective, _ := cmd.Flags().GetBool("effective")
+		if !effective {
+			for _, layer := range configLayers {
+				fmt.Fprintln(cmd.OutOrStdout(), layer)
+			}
+			return nil
+		}
+
+		out, err := effectiveConfig()
+		if err != nil {
+			return err
+		}
+		_, err = cmd.OutOrStdout().Write(out)
+		return err
+	},
+}
+
+// discoverConfigs returns the config files layered over the embedded config,
+// lowest precedence first: $XDG_CONFIG_HOME/kh/*.yml, then the project's
+// .kh.yml, then any files passed with --config. The project's file is only
+// listed once, where --config puts it if it was passed explicitly.
+func discoverConfigs() ([]string, error) {
+	var paths []string
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+	if dir != "" {
+		// Glob returns matches in lexical order, which sets precedence
+		// between the user's files
+		matches, err := filepath.Glob(filepath.Join(dir, "kh", "*.yml"))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+
+	if _, err := os.Stat(projectConfig); err == nil {
+		if !explicitConfig(projectConfig) {
+			paths = append(paths, projectConfig)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return append(paths, configFiles...), nil
+}
+
+// explicitConfig reports whether path was passed with --config
+func explicitConfig(path string) bool {
+	return slices.ContainsFunc(configFiles, func(f string) bool {
+		return filepath.Clean(f) == filepath.Clean(path)
+	})
+}
+
+// loadConfigs layers every discovered config file over the embedded config.
+// The project's .kh.yml comes with whatever checkout kh runs in, so unless it
+// is passed with --config it may only add services: redefining one could send
+// its tokens elsewhere. The services it tried to override are reported to
+// stderr.
+func loadConfigs(stderr io.Writer) error {
+	paths, err := discoverConfigs()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if path != projectConfig || explicitConfig(path) {
+			if err := registry.LoadFile(path); err != nil {
+				return err
+			}
+			configLayers = append(configLayers, path)
+			continue
+		}
+
+		skipped, err := registry.AddFile(path)
+		if err != nil {
+			return err
+		}
+		configLayers = append(configLayers, path)
+		if len(skipped) > 0 {
+			fmt.Fprintf(stderr, "Warning: %s may only add services, ignoring its definitions of %s; "+
+				"pass it with --config %s to override them\n", path, strings.Join(skipped, ", "), path)
+		}
+	}
+
+	return nil
+}
+
+// effectiveConfig renders the merged registry as YAML, noting above each
+// service the files it came from
+func effectiveConfig() ([]byte, error) {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, service := range registry.Services() {
+		key := &yaml.Node{
+			Kind:        yaml.ScalarNode,
+			Value:       service.Name,
+			HeadComment: "from: " + strings.Join(service.Sources, ", "),
+		}
+
+		value := &yaml.Node{}
+		if err := value.Encode(service); err != nil {
+			return nil, fmt.Errorf("failed to render service %q: %w", service.Name, err)
+		}
+
+		doc.Content = append(doc.Content, key, value)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
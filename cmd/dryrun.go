@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/audibleblink/kh/pkg/keyhack"
+	"github.com/audibleblink/kh/pkg/registry"
+)
+
+// Dry-run formats
+const (
+	dryRunCurl = "curl"
+	dryRunHTTP = "http"
+)
+
+// dryRun prints requests in this format instead of sending them
+var dryRun string
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&dryRun, "dry-run", "",
+		"print each request as a curl command or raw http instead of sending it")
+	flags.Lookup("dry-run").NoOptDefVal = dryRunCurl
+}
+
+// checkDryRun makes sure --dry-run names a format
+func checkDryRun() error {
+	switch dryRun {
+	case "", dryRunCurl, dryRunHTTP:
+		return nil
+	default:
+		return configError(fmt.Errorf("--dry-run: unknown format %q, want curl or http", dryRun))
+	}
+}
+
+// printRequest writes the request the service would send for token
+func printRequest(w io.Writer, service *keyhack.KeyHack, token string) error {
+	req, err := service.Prepare(token, keyhack.Redact)
+	if err != nil {
+		return err
+	}
+
+	var out string
+	switch dryRun {
+	case dryRunCurl:
+		out, err = req.Curl()
+	case dryRunHTTP:
+		out, err = req.HTTP()
+	default:
+		return fmt.Errorf("unknown dry-run format %q", dryRun)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, out)
+	return err
+}
+
+// printRequests prints the requests for every check instead of sending them,
+// each preceded by a comment naming its service if withService is set. Checks
+// whose requests can't be prepared are reported on stderr with the error.
+func printRequests(cmd *cobra.Command, checks <-chan check, withService bool) error {
+	failed := false
+	for c := range checks {
+		if err := printCheck(cmd, c, withService); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s\t%s\n", redacted(c.token), err)
+			failed = true
+		}
+	}
+
+	if failed {
+		return errors.New("some requests could not be prepared")
+	}
+	return nil
+}
+
+// printCheck prints the requests a check would send: one for its service,
+// or one per candidate service in auto mode
+func printCheck(cmd *cobra.Command, c check, withService bool) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	var services []*keyhack.KeyHack
+	if c.auto {
+		var err error
+		if services, err = autoCandidates(registry.Services(), c.token); err != nil {
+			return err
+		}
+		if len(services) == 0 && verbose {
+			fmt.Fprintf(cmd.ErrOrStderr(), "no candidates\t%s\n", redacted(c.token))
+		}
+	} else {
+		service, ok := keyhack.Registry.GetService(c.service)
+		if !ok {
+			return fmt.Errorf("service %q not configured", c.service)
+		}
+		services = []*keyhack.KeyHack{service}
+	}
+
+	for _, service := range services {
+		if withService {
+			fmt.Fprintf(cmd.OutOrStdout(), "# %s\n", service.Name)
+		}
+		if err := printRequest(cmd.OutOrStdout(), service, c.token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redacted masks the token for messages, unless --no-redact was given
+func redacted(token string) string {
+	if keyhack.Redact {
+		return keyhack.Mask(token)
+	}
+	return token
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/audibleblink/kh/pkg/keyhack"
+)
+
+// Exit statuses
+const (
+	// exitOK means at least one token was valid, or nothing was checked
+	exitOK = 0
+	// exitInvalid means every token checked was invalid
+	exitInvalid = 1
+	// exitError means no token was valid and some checks couldn't reach a
+	// verdict, or kh failed while running
+	exitError = 2
+	// exitConfig means the configuration or the command line is wrong
+	exitConfig = 3
+)
+
+var (
+	// failOn lists the statuses that make kh exit with exitInvalid, in
+	// place of the default scheme
+	failOn []string
+
+	// tally counts the results reported by status
+	tally = make(map[keyhack.Status]int)
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringSliceVar(&failOn, "fail-on", nil,
+		"exit 1 if any token is valid, invalid or unknown (comma-separated), and 0 otherwise")
+
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return configError(err)
+	})
+}
+
+// statusError is an error that sets the exit status
+type statusError struct {
+	code int
+	err  error
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+func (e *statusError) Unwrap() error { return e.err }
+
+// configError marks err as a configuration or usage error
+func configError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &statusError{exitConfig, err}
+}
+
+// checkFailOn makes sure --fail-on only names statuses
+func checkFailOn() error {
+	for _, status := range failOn {
+		switch status {
+		case keyhack.StatusValid.String(), keyhack.StatusInvalid.String(), keyhack.StatusUnknown.String():
+		default:
+			return configError(fmt.Errorf("--fail-on: unknown status %q, want valid, invalid or unknown", status))
+		}
+	}
+	return nil
+}
+
+// exitStatus works out the exit status from the error the command returned
+// and the results it reported
+func exitStatus(err error) int {
+	var se *statusError
+	switch {
+	case errors.As(err, &se):
+		return se.code
+	case err != nil:
+		return exitError
+	}
+
+	if len(failOn) > 0 {
+		for status, n := range tally {
+			if n > 0 && slices.Contains(failOn, status.String()) {
+				return exitInvalid
+			}
+		}
+		return exitOK
+	}
+
+	switch {
+	case tally[keyhack.StatusValid] > 0:
+		return exitOK
+	case tally[keyhack.StatusUnknown] > 0:
+		return exitError
+	case tally[keyhack.StatusInvalid] > 0:
+		return exitInvalid
+	default:
+		return exitOK
+	}
+}
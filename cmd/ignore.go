@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is one pattern from a .gitignore file
+type ignoreRule struct {
+	// dir is the slash-separated directory of the .gitignore file, relative
+	// to the root of the scan, or "" for the root itself
+	dir string
+
+	re *regexp.Regexp
+
+	// base matches the pattern against the last element of the path only,
+	// for patterns without a slash
+	base bool
+
+	// dirOnly matches directories only, for patterns ending in a slash
+	dirOnly bool
+
+	// negate re-includes what earlier patterns excluded
+	negate bool
+}
+
+// ignorer applies the .gitignore files found while walking a tree
+type ignorer struct {
+	rules []ignoreRule
+}
+
+// load reads the .gitignore file in dir, if there is one. rel is dir
+// relative to the root of the scan, slash-separated.
+func (ig *ignorer) load(dir, rel string) error {
+	f, err := os.Open(dir + string(os.PathSeparator) + ".gitignore")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if rel == "." {
+		rel = ""
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			rule.dir = rel
+			ig.rules = append(ig.rules, rule)
+		}
+	}
+	return scanner.Err()
+}
+
+// ignored reports whether the path, slash-separated and relative to the root
+// of the scan, is excluded. The last matching pattern wins.
+func (ig *ignorer) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range ig.rules {
+		sub := rel
+		if rule.dir != "" {
+			var ok bool
+			if sub, ok = strings.CutPrefix(rel, rule.dir+"/"); !ok {
+				continue
+			}
+		}
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.base {
+			sub = path.Base(sub)
+		}
+		if rule.re.MatchString(sub) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// parseIgnoreRule parses a line of a .gitignore file, returning false for
+// blank lines and comments
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(strings.TrimSuffix(line, "\r"), " ")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// A slash anywhere but at the end anchors the pattern to its directory
+	rule.base = !strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	re, err := regexp.Compile("^" + globRegexp(line) + "$")
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// globRegexp translates a .gitignore glob into a regular expression: * and ?
+// don't cross slashes, while ** matches any number of directories
+func globRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString(`(?:.*/)?`)
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(`.*`)
+			i++
+		case c == '*':
+			b.WriteString(`[^/]*`)
+		case c == '?':
+			b.WriteString(`[^/]`)
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return b.String()
+}
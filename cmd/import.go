@@ -0,0 +1,300 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/audibleblink/kh/pkg/keyhack"
+	"github.com/audibleblink/kh/pkg/registry"
+)
+
+// importField is the key under which the verdict is added to each finding
+const importField = "kh"
+
+// findingReader reads the rule and secret of one finding in a scanner's
+// report
+type findingReader func(raw json.RawMessage) (rule, secret string, err error)
+
+// scanners are the report formats kh import understands
+var scanners = map[string]findingReader{
+	"gitleaks":   gitleaksFinding,
+	"trufflehog": trufflehogFinding,
+}
+
+var (
+	// importOut is where the enriched report is written, stdout by default
+	importOut string
+
+	// importMap holds RULE=SERVICE overrides of the services' rules
+	importMap []string
+)
+
+func init() {
+	importCmd.Flags().StringVarP(&importOut, "output", "o", "",
+		"write the enriched report to this file instead of stdout")
+	importCmd.Flags().StringArrayVar(&importMap, "map", nil,
+		"check findings of a rule or detector as a service, as RULE=SERVICE (repeatable)")
+	rootCmd.AddCommand(importCmd)
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <gitleaks|trufflehog> [report]",
+	Short: "Check the findings of a gitleaks or TruffleHog report",
+	Long: "Check the secrets found by gitleaks or TruffleHog, reading their JSON report from the " +
+		"file given or from stdin, and write the report back with kh's verdict added to each " +
+		"finding under \"" + importField + "\".\n" +
+		"Rule and detector IDs are matched to services through the rules of each service in " +
+		"the configuration, and --map. Findings of other rules are marked \"unchecked\".",
+	Example: "  gitleaks detect --report-path leaks.json; kh import gitleaks leaks.json -o checked.json\n" +
+		"  trufflehog git file://. --json | kh import trufflehog --map AWS=aws",
+	SilenceUsage: true,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.RangeArgs(1, 2)(cmd, args); err != nil {
+			return configError(err)
+		}
+		if _, ok := scanners[args[0]]; !ok {
+			return configError(fmt.Errorf("unknown scanner %q, want gitleaks or trufflehog", args[0]))
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rules, err := ruleTable(args[0])
+		if err != nil {
+			return configError(err)
+		}
+
+		var in io.Reader = cmd.InOrStdin()
+		if len(args) > 1 && args[1] != "-" {
+			f, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+
+		findings, array, err := readReport(in)
+		if err != nil {
+			return err
+		}
+
+		plan, err := planFindings(scanners[args[0]], rules, findings)
+		if err != nil {
+			return err
+		}
+		if dryRun != "" {
+			return printRequests(cmd, sendChecks(plan.checks), true)
+		}
+		plan.run(cmd)
+
+		var out io.Writer = cmd.OutOrStdout()
+		if importOut != "" {
+			f, err := os.Create(importOut)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+
+		if err := writeReport(out, findings, plan.verdicts, array); err != nil {
+			return err
+		}
+		return interrupted(cmd.Context())
+	},
+}
+
+// ruleTable maps the scanner's rule IDs, in lowercase, to services, from the
+// configuration and --map
+func ruleTable(scanner string) (map[string]string, error) {
+	rules := make(map[string]string)
+	for _, service := range registry.Services() {
+		for _, rule := range service.Rules[scanner] {
+			rules[strings.ToLower(rule)] = service.Name
+		}
+	}
+
+	for _, m := range importMap {
+		rule, service, ok := strings.Cut(m, "=")
+		if !ok || rule == "" || service == "" {
+			return nil, fmt.Errorf("--map %q: want RULE=SERVICE", m)
+		}
+		if _, ok := registry.GetService(service); !ok {
+			return nil, fmt.Errorf("--map %q: service %q not configured", m, service)
+		}
+		rules[strings.ToLower(rule)] = service
+	}
+
+	return rules, nil
+}
+
+// findingPlan is how the findings of a report are checked
+type findingPlan struct {
+	// verdicts holds one record per finding, "unchecked" until its check
+	// is done
+	verdicts []record
+
+	// checks are the distinct services and secrets to check, and index
+	// the findings each one covers
+	checks []check
+	index  map[check][]int
+}
+
+// planFindings works out a check for every finding whose rule maps to a
+// service, each distinct one only once
+func planFindings(finding findingReader, rules map[string]string, findings []json.RawMessage) (*findingPlan, error) {
+	plan := &findingPlan{
+		verdicts: make([]record, len(findings)),
+		index:    make(map[check][]int),
+	}
+
+	for i, raw := range findings {
+		rule, secret, err := finding(raw)
+		if err != nil {
+			return nil, fmt.Errorf("finding %d: %w", i+1, err)
+		}
+
+		service, ok := rules[strings.ToLower(rule)]
+		switch {
+		case !ok:
+			plan.verdicts[i] = record{Status: "unchecked", Reason: fmt.Sprintf("no service for rule %q", rule)}
+		case secret == "":
+			plan.verdicts[i] = record{Service: service, Status: "unchecked", Reason: "no secret in finding"}
+		default:
+			c := check{service: service, token: secret}
+			if _, seen := plan.index[c]; !seen {
+				plan.checks = append(plan.checks, c)
+			}
+			plan.index[c] = append(plan.index[c], i)
+			plan.verdicts[i] = record{Service: service, Token: secret, Status: "unchecked", Reason: "interrupted"}
+		}
+	}
+
+	return plan, nil
+}
+
+// run checks every distinct secret and fills in the verdicts of the findings
+// it was found in
+func (p *findingPlan) run(cmd *cobra.Command) {
+	runChecks(cmd.Context(), sendChecks(p.checks), concurrency, false, func(result keyhack.Result) {
+		tally[result.Status]++
+		for _, i := range p.index[check{service: result.Service, token: result.Token}] {
+			p.verdicts[i] = newRecord(result)
+		}
+	})
+}
+
+// readReport reads the findings of a report that is either a JSON array or a
+// stream of JSON objects, one per line
+func readReport(r io.Reader) (findings []json.RawMessage, array bool, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err := json.Unmarshal(data, &findings); err != nil {
+			return nil, true, fmt.Errorf("invalid report: %w", err)
+		}
+		return findings, true, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); errors.Is(err, io.EOF) {
+			return findings, false, nil
+		} else if err != nil {
+			return nil, false, fmt.Errorf("invalid report: %w", err)
+		}
+		findings = append(findings, raw)
+	}
+}
+
+// writeReport writes the findings back in the shape they were read, each
+// with its verdict added
+func writeReport(w io.Writer, findings []json.RawMessage, verdicts []record, array bool) error {
+	enriched := make([]json.RawMessage, len(findings))
+	for i, raw := range findings {
+		var err error
+		if enriched[i], err = addField(raw, importField, verdicts[i]); err != nil {
+			return fmt.Errorf("finding %d: %w", i+1, err)
+		}
+	}
+
+	if !array {
+		for _, raw := range enriched {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, raw); err != nil {
+				return err
+			}
+			buf.WriteByte('\n')
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if enriched == nil {
+		enriched = []json.RawMessage{}
+	}
+	out, err := json.MarshalIndent(enriched, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(out, '\n'))
+	return err
+}
+
+// addField adds a key to a JSON object, leaving the rest of it untouched
+func addField(raw json.RawMessage, key string, value any) (json.RawMessage, error) {
+	obj := bytes.TrimSpace(raw)
+	if len(obj) < 2 || obj[0] != '{' || obj[len(obj)-1] != '}' {
+		return nil, errors.New("finding is not a JSON object")
+	}
+
+	k, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	body := bytes.TrimSpace(obj[1 : len(obj)-1])
+	out := []byte{'{'}
+	if len(body) > 0 {
+		out = append(append(out, body...), ',')
+	}
+	out = append(append(append(out, k...), ':'), v...)
+	return append(out, '}'), nil
+}
+
+// gitleaksFinding reads a finding from a gitleaks JSON report
+func gitleaksFinding(raw json.RawMessage) (string, string, error) {
+	var f struct {
+		RuleID string
+		Secret string
+	}
+	err := json.Unmarshal(raw, &f)
+	return f.RuleID, f.Secret, err
+}
+
+// trufflehogFinding reads a finding from TruffleHog's --json output
+func trufflehogFinding(raw json.RawMessage) (string, string, error) {
+	var f struct {
+		DetectorName string
+		Raw          string
+	}
+	err := json.Unmarshal(raw, &f)
+	return f.DetectorName, f.Raw, err
+}
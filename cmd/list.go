@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/audibleblink/kh/pkg/keyhack"
+	"github.com/audibleblink/kh/pkg/registry"
+)
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Describe every configured service",
+	Long: "Describe every configured service: its credential shape, the request it sends, " +
+		"whether it needs a custom validator and the config files it came from.\n" +
+		"--format json or jsonl prints the same for tooling.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var entries []serviceEntry
+		for _, service := range registry.Services() {
+			entries = append(entries, newServiceEntry(service))
+		}
+		return writeServices(cmd.OutOrStdout(), entries)
+	},
+}
+
+// serviceEntry is the description of a service printed by kh list
+type serviceEntry struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Credential  string   `json:"credential"`
+	Method      string   `json:"method"`
+	Host        string   `json:"host"`
+	Custom      bool     `json:"custom_validator"`
+	Sources     []string `json:"sources"`
+}
+
+// newServiceEntry describes a service
+func newServiceEntry(service *keyhack.KeyHack) serviceEntry {
+	return serviceEntry{
+		Name:        service.Name,
+		Description: service.Description,
+		Credential:  credentialShape(service),
+		Method:      service.Method,
+		Host:        urlHost(service.URL),
+		Custom:      service.Validator.Custom,
+		Sources:     service.Sources,
+	}
+}
+
+// writeServices prints the entries as a table, or in the chosen format
+func writeServices(w io.Writer, entries []serviceEntry) error {
+	switch format {
+	case formatText:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tCREDENTIAL\tMETHOD\tHOST\tCUSTOM\tSOURCE\tDESCRIPTION")
+		for _, e := range entries {
+			custom := "-"
+			if e.Custom {
+				custom = "yes"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				e.Name, e.Credential, e.Method, e.Host, custom, strings.Join(e.Sources, ","), e.Description)
+		}
+		return tw.Flush()
+
+	case formatJSON:
+		if entries == nil {
+			entries = []serviceEntry{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+
+	case formatJSONL:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return configError(fmt.Errorf("kh list supports the text, json and jsonl formats, not %q", format))
+	}
+}
+
+// credentialShape describes the credential a service expects, such as
+// <client_id:client_secret>
+func credentialShape(service *keyhack.KeyHack) string {
+	if service.Placeholder != "" {
+		return service.Placeholder
+	}
+	return service.Credential.Shape()
+}
+
+// urlHost returns the host of a URL template, leaving out any userinfo and
+// port. Templates in the host are kept as written.
+func urlHost(tmpl string) string {
+	rest := tmpl
+	if _, after, ok := strings.Cut(rest, "://"); ok {
+		rest = after
+	}
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		rest = rest[i+1:]
+	}
+	if strings.HasPrefix(rest, "[") {
+		if i := strings.Index(rest, "]"); i >= 0 {
+			return rest[:i+1]
+		}
+	}
+	if i := strings.LastIndex(rest, ":"); i >= 0 && !strings.Contains(rest[i:], "}}") {
+		rest = rest[:i]
+	}
+	return rest
+}
@@ -0,0 +1,271 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/audibleblink/kh/pkg/keyhack"
+)
+
+// Output formats
+const (
+	formatText  = "text"
+	formatJSON  = "json"
+	formatJSONL = "jsonl"
+	formatCSV   = "csv"
+)
+
+var (
+	// format selects how results are printed
+	format = formatText
+
+	// tmpl is a text/template executed for every result, overriding format
+	tmpl string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&format, "format", format,
+		"output format: text, json, jsonl or csv")
+	rootCmd.PersistentFlags().StringVar(&tmpl, "template", "",
+		"Go text/template applied to each result, e.g. '{{.Service}} {{.Token}}'")
+}
+
+// resultWriter prints results in one of the output formats
+type resultWriter interface {
+	Write(keyhack.Result) error
+	Close() error
+}
+
+// newResultWriter returns a writer for the format chosen on the command
+// line. Shown results that aren't valid go to the --show-out file if one was
+// given. In text, withService prints the service before each token.
+func newResultWriter(w io.Writer, withService bool) (resultWriter, error) {
+	if showOut == "" {
+		return newFormatWriter(w, &textWriter{w: w, service: withService, status: showsInvalid()})
+	}
+
+	out, err := newFormatWriter(w, &textWriter{w: w, service: withService})
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(showOut)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := newFormatWriter(f, &textWriter{w: f, service: withService, status: true})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &splitWriter{valid: out, rest: rest, file: f}, nil
+}
+
+// newFormatWriter returns a writer to w for the chosen format, using text
+// for the text format
+func newFormatWriter(w io.Writer, text *textWriter) (resultWriter, error) {
+	if tmpl != "" {
+		t, err := template.New("result").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		return &templateWriter{w: w, t: t}, nil
+	}
+
+	if format == formatText {
+		return text, nil
+	}
+	out, err := newStructuredWriter(w, recordHeader, recordRow)
+	if err != nil {
+		return nil, err
+	}
+	return &recordWriter{out: out}, nil
+}
+
+// record is the serialised form of a result
+type record struct {
+	Service    string `json:"service"`
+	Token      string `json:"token"`
+	Status     string `json:"status"`
+	Reason     string `json:"reason,omitempty"`
+	HTTPStatus int    `json:"http_status,omitempty"`
+	Attempts   int    `json:"attempts"`
+	LatencyMS  int64  `json:"latency_ms"`
+	Error      string `json:"error,omitempty"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// newRecord flattens a result for serialisation
+func newRecord(result keyhack.Result) record {
+	r := record{
+		Service:    result.Service,
+		Token:      result.Token,
+		Status:     result.Status.String(),
+		Reason:     result.Reason,
+		HTTPStatus: result.HTTPStatus,
+		Attempts:   result.Attempts,
+		LatencyMS:  result.Latency.Milliseconds(),
+		Metadata:   result.Metadata,
+	}
+	if result.Err != nil {
+		r.Error = result.Err.Error()
+	}
+	return r
+}
+
+// textWriter prints the bare token, one per line, optionally preceded by
+// the status and reason, then the service, separated by tabs
+type textWriter struct {
+	w       io.Writer
+	service bool
+	status  bool
+}
+
+func (t *textWriter) Write(result keyhack.Result) error {
+	var fields []string
+	if t.status {
+		fields = append(fields, result.Status.String(), result.Reason)
+	}
+	if t.service {
+		fields = append(fields, result.Service)
+	}
+	fields = append(fields, result.Token)
+
+	_, err := fmt.Fprintln(t.w, strings.Join(fields, "\t"))
+	return err
+}
+
+func (t *textWriter) Close() error { return nil }
+
+// templateWriter executes a template for every result, adding a newline
+type templateWriter struct {
+	w io.Writer
+	t *template.Template
+}
+
+func (t *templateWriter) Write(result keyhack.Result) error {
+	if err := t.t.Execute(t.w, result); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(t.w)
+	return err
+}
+
+func (t *templateWriter) Close() error { return nil }
+
+// recordHeader and recordRow lay results out in CSV
+var recordHeader = []string{"service", "token", "status", "reason", "http_status", "attempts", "latency_ms", "error", "metadata"}
+
+func recordRow(r record) [][]string {
+	return [][]string{{
+		r.Service,
+		r.Token,
+		r.Status,
+		r.Reason,
+		strconv.Itoa(r.HTTPStatus),
+		strconv.Itoa(r.Attempts),
+		strconv.FormatInt(r.LatencyMS, 10),
+		r.Error,
+		joinMetadata(r.Metadata),
+	}}
+}
+
+// recordWriter prints results as records in a structured format
+type recordWriter struct {
+	out *structuredWriter[record]
+}
+
+func (r *recordWriter) Write(result keyhack.Result) error {
+	return r.out.write(newRecord(result))
+}
+
+func (r *recordWriter) Close() error { return r.out.close() }
+
+// structuredWriter prints values in one of the structured formats: a single
+// JSON array, streaming its elements, one JSON object per line, or CSV with
+// a header row. rows lays a value out in any number of CSV rows.
+type structuredWriter[T any] struct {
+	w      io.Writer
+	format string
+	csv    *csv.Writer
+	rows   func(T) [][]string
+	count  int
+}
+
+// newStructuredWriter returns a writer to w for the chosen format, which
+// must be json, jsonl or csv
+func newStructuredWriter[T any](w io.Writer, header []string, rows func(T) [][]string) (*structuredWriter[T], error) {
+	s := &structuredWriter[T]{w: w, format: format, rows: rows}
+
+	switch format {
+	case formatJSON, formatJSONL:
+	case formatCSV:
+		s.csv = csv.NewWriter(w)
+		if err := s.csv.Write(header); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+
+	return s, nil
+}
+
+func (s *structuredWriter[T]) write(v T) error {
+	switch s.format {
+	case formatJSONL:
+		return json.NewEncoder(s.w).Encode(v)
+
+	case formatJSON:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		sep := ",\n  "
+		if s.count == 0 {
+			sep = "[\n  "
+		}
+		s.count++
+		_, err = fmt.Fprintf(s.w, "%s%s", sep, raw)
+		return err
+	}
+
+	// Flush as we go so results show up while checks are still running
+	return s.csv.WriteAll(s.rows(v))
+}
+
+func (s *structuredWriter[T]) close() error {
+	switch s.format {
+	case formatJSON:
+		if s.count == 0 {
+			_, err := fmt.Fprintln(s.w, "[]")
+			return err
+		}
+		_, err := fmt.Fprintln(s.w, "\n]")
+		return err
+	case formatCSV:
+		s.csv.Flush()
+		return s.csv.Error()
+	}
+	return nil
+}
+
+// joinMetadata flattens metadata into sorted key=value pairs separated by
+// semicolons, for formats without nesting
+func joinMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for _, k := range slices.Sorted(maps.Keys(metadata)) {
+		pairs = append(pairs, k+"="+metadata[k])
+	}
+	return strings.Join(pairs, "; ")
+}
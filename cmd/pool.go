@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"context"
+	"sync"
+
+	"github.com/audibleblink/kh/pkg/keyhack"
+	"github.com/audibleblink/kh/pkg/registry"
+)
+
+var (
+	// concurrency is the number of checks run at once
+	concurrency = 1
+
+	// ordered keeps output in input order when checks run concurrently
+	ordered bool
+)
+
+func init() {
+	rootCmd.PersistentFlags().IntVar(&concurrency, "concurrency", concurrency,
+		"number of tokens to check at once")
+	rootCmd.PersistentFlags().BoolVar(&ordered, "ordered", false,
+		"print results in input order when checking concurrently")
+}
+
+// check is a single token to validate against a service
+type check struct {
+	service string
+	token   string
+
+	// auto tries the token against the services it may belong to instead,
+	// see verifyAuto
+	auto bool
+
+	// err is a problem with the input, reported instead of a verdict
+	err error
+}
+
+// verify checks the token and returns the verdict
+func (c check) verify(ctx context.Context) keyhack.Result {
+	if c.err != nil {
+		return keyhack.Result{Service: c.service, Token: c.token, Reason: "bad input", Err: c.err}
+	}
+	if c.auto {
+		return verifyAuto(ctx, registry.Services(), c.token)
+	}
+	return keyhack.VerifyContext(ctx, c.service, c.token)
+}
+
+// sendChecks feeds the checks to the returned channel, closing it after the
+// last one
+func sendChecks(checks []check) <-chan check {
+	ch := make(chan check)
+	go func() {
+		defer close(ch)
+		for _, c := range checks {
+			ch <- c
+		}
+	}()
+	return ch
+}
+
+// runChecks validates every check received with the given number of workers
+// and hands each result to emit. emit is only ever called from the calling
+// goroutine; with keepOrder set, results are emitted in the order their
+// checks were received. Once ctx is done no more checks are taken, checks in
+// flight end as unknown, and runChecks returns after emitting them.
+func runChecks(ctx context.Context, checks <-chan check, workers int, keepOrder bool, emit func(keyhack.Result)) {
+	type job struct {
+		seq int
+		check
+	}
+	type done struct {
+		seq int
+		keyhack.Result
+	}
+
+	workers = max(workers, 1)
+	jobs := make(chan job)
+	results := make(chan done)
+
+	// Number the checks so order can be restored
+	go func() {
+		defer close(jobs)
+		for seq := 0; ; seq++ {
+			var (
+				c  check
+				ok bool
+			)
+			select {
+			case <-ctx.Done():
+				return
+			case c, ok = <-checks:
+			}
+			if !ok {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- job{seq, c}:
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results <- done{j.seq, j.verify(ctx)}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	if !keepOrder {
+		for r := range results {
+			emit(r.Result)
+		}
+		return
+	}
+
+	// Hold on to early finishers until everything before them is out
+	pending := make(map[int]keyhack.Result)
+	next := 0
+	for r := range results {
+		pending[r.seq] = r.Result
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			emit(result)
+			next++
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/audibleblink/kh/pkg/keyhack"
+	"github.com/audibleblink/kh/pkg/registry"
+)
+
+// binarySniffLen is how much of a file is searched for a NUL byte to tell
+// binaries apart, as git does
+const binarySniffLen = 8000
+
+var (
+	// maxScanSize is the size above which files are skipped, in bytes
+	maxScanSize int64 = 1 << 20
+
+	// noIgnore scans files that .gitignore excludes too
+	noIgnore bool
+)
+
+func init() {
+	scanCmd.Flags().Int64Var(&maxScanSize, "max-size", maxScanSize,
+		"skip files larger than this many bytes")
+	scanCmd.Flags().BoolVar(&noIgnore, "no-ignore", false,
+		"scan files excluded by .gitignore too")
+	rootCmd.AddCommand(scanCmd)
+}
+
+var scanCmd = &cobra.Command{
+	Use:   "scan [path...]",
+	Short: "Find and check credentials in files",
+	Long: "Search the files under each path, the current directory by default, for tokens " +
+		"matching the pattern of a service, and check every one found.\n" +
+		"Directories excluded by .gitignore, .git itself, binary files and files larger " +
+		"than --max-size are skipped. Each result is printed with the file, line and column " +
+		"the token was found at; --show picks which are printed, as for other commands. With " +
+		"--dry-run, the request for each distinct token is printed instead.",
+	Example: "  kh scan\n" +
+		"  kh scan --show all --format jsonl src/ config/",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			args = []string{"."}
+		}
+		if tmpl != "" || showOut != "" {
+			return configError(errors.New("--template and --show-out aren't supported by scan"))
+		}
+
+		out, err := newFindingWriter(cmd.OutOrStdout())
+		if err != nil {
+			return configError(err)
+		}
+
+		s := &treeScanner{services: registry.Services(), stderr: cmd.ErrOrStderr()}
+		for _, root := range args {
+			if err := s.walk(root); err != nil {
+				return err
+			}
+		}
+
+		if dryRun != "" {
+			return printRequests(cmd, sendChecks(s.checks), true)
+		}
+
+		runChecks(cmd.Context(), sendChecks(s.checks), concurrency, ordered, func(result keyhack.Result) {
+			tally[result.Status]++
+			locations := s.found[check{service: result.Service, token: result.Token}]
+
+			if !shown[result.Status] {
+				if result.Status == keyhack.StatusUnknown || verbose {
+					for _, loc := range locations {
+						fmt.Fprintf(cmd.ErrOrStderr(), "%s\t%s\t%s\t%s\n", loc, result.Status, result.Reason, result.Service)
+					}
+				}
+				return
+			}
+			for _, loc := range locations {
+				if err == nil {
+					err = out.write(finding{loc.file, loc.line, loc.column, newRecord(result)})
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := out.close(); err != nil {
+			return err
+		}
+		return interrupted(cmd.Context())
+	},
+}
+
+// location is where a token was found
+type location struct {
+	file         string
+	line, column int
+}
+
+func (l location) String() string {
+	return fmt.Sprintf("%s:%d:%d", l.file, l.line, l.column)
+}
+
+// treeScanner searches files for tokens, collecting a check per distinct
+// service and token along with every place it was found
+type treeScanner struct {
+	services []*keyhack.KeyHack
+	stderr   io.Writer
+
+	checks []check
+	found  map[check][]location
+}
+
+// walk scans root, a file or a directory tree
+func (s *treeScanner) walk(root string) error {
+	var ig ignorer
+
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable parts of the tree don't stop the scan
+			if p == root {
+				return err
+			}
+			fmt.Fprintf(s.stderr, "skipped\t%s\t%s\n", err, p)
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if p != root && (d.Name() == ".git" || !noIgnore && ig.ignored(rel, true)) {
+				return filepath.SkipDir
+			}
+			if !noIgnore {
+				return ig.load(p, rel)
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() || p != root && !noIgnore && ig.ignored(rel, false) {
+			return nil
+		}
+		return s.scanFile(p, d)
+	})
+}
+
+// scanFile searches one file, unless it is too large or binary
+func (s *treeScanner) scanFile(p string, d fs.DirEntry) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+	if info.Size() > maxScanSize {
+		if verbose {
+			fmt.Fprintf(s.stderr, "skipped\ttoo large\t%s\n", p)
+		}
+		return nil
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		fmt.Fprintf(s.stderr, "skipped\t%s\t%s\n", err, p)
+		return nil
+	}
+	if bytes.IndexByte(data[:min(len(data), binarySniffLen)], 0) >= 0 {
+		if verbose {
+			fmt.Fprintf(s.stderr, "skipped\tbinary\t%s\n", p)
+		}
+		return nil
+	}
+
+	return s.scanText(p, string(data))
+}
+
+// scanText collects the tokens in text, a file's contents
+func (s *treeScanner) scanText(file, text string) error {
+	if s.found == nil {
+		s.found = make(map[check][]location)
+	}
+
+	type match struct {
+		service    string
+		start, end int
+	}
+
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		var matches []match
+		for _, service := range s.services {
+			found, err := service.FindAll(line)
+			if err != nil {
+				return configError(err)
+			}
+			for _, m := range found {
+				matches = append(matches, match{service.Name, m[0], m[1]})
+			}
+		}
+
+		for _, m := range matches {
+			// Part of a longer credential of another service, such as the key
+			// of a key:secret pair, which mustn't be sent anywhere else
+			inside := slices.ContainsFunc(matches, func(o match) bool {
+				return o.start <= m.start && m.end <= o.end && o.end-o.start > m.end-m.start
+			})
+			if inside {
+				continue
+			}
+
+			c := check{service: m.service, token: line[m.start:m.end]}
+			if _, seen := s.found[c]; !seen {
+				s.checks = append(s.checks, c)
+			}
+			s.found[c] = append(s.found[c], location{file, i + 1, m.start + 1})
+		}
+	}
+	return nil
+}
+
+// finding is a checked token and where it was found
+type finding struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	record
+}
+
+// findingWriter prints findings in the format chosen on the command line
+type findingWriter struct {
+	w   io.Writer
+	out *structuredWriter[finding]
+}
+
+func newFindingWriter(w io.Writer) (*findingWriter, error) {
+	if format == formatText {
+		return &findingWriter{w: w}, nil
+	}
+
+	header := []string{"file", "line", "column", "service", "token", "status", "reason", "http_status", "error", "metadata"}
+	out, err := newStructuredWriter(w, header, func(fd finding) [][]string {
+		return [][]string{{
+			fd.File,
+			strconv.Itoa(fd.Line),
+			strconv.Itoa(fd.Column),
+			fd.Service,
+			fd.Token,
+			fd.Status,
+			fd.Reason,
+			strconv.Itoa(fd.HTTPStatus),
+			fd.Error,
+			joinMetadata(fd.Metadata),
+		}}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &findingWriter{w: w, out: out}, nil
+}
+
+func (f *findingWriter) write(fd finding) error {
+	if f.out != nil {
+		return f.out.write(fd)
+	}
+	_, err := fmt.Fprintf(f.w, "%s:%d:%d\t%s\t%s\t%s\n", fd.File, fd.Line, fd.Column, fd.Service, fd.Status, fd.Token)
+	return err
+}
+
+func (f *findingWriter) close() error {
+	if f.out != nil {
+		return f.out.close()
+	}
+	return nil
+}
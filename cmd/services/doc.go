@@ -0,0 +1,18 @@
+// Package services holds custom validators for services whose responses
+// can't be described declaratively in keyhacks.yml.
+//
+// Service commands are generated from the configuration, so a file is only
+// needed here when a service sets `custom: true` in its validator block.
+// Each file queues its validator from an init function; the name must match
+// the service's key in the YAML file:
+//
+//	func init() {
+//		cli.RegisterValidator("sass-api", validateSass)
+//	}
+//
+//	// validateSass defines what a successful authentication looks like
+//	// based on the HTTP response of the API call
+//	func validateSass(resp *http.Response) (bool, error) {
+//		return resp.Header.Get("X-Sass-User") != "", nil
+//	}
+package services
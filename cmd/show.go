@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/audibleblink/kh/pkg/keyhack"
+)
+
+var (
+	// show lists the statuses written to the output: valid, invalid,
+	// errors or all
+	show []string
+
+	// invert shows everything but the valid tokens
+	invert bool
+
+	// showOut receives the shown results that aren't valid, instead of
+	// stdout
+	showOut string
+
+	// shown is the set of statuses written to the output, worked out from
+	// the flags above
+	shown = map[keyhack.Status]bool{keyhack.StatusValid: true}
+)
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringSliceVar(&show, "show", nil,
+		"results to output: valid, invalid, errors or all, comma-separated (default valid)")
+	flags.BoolVar(&invert, "invert", false,
+		"output the invalid and unknown tokens instead of the valid ones, like --show invalid,errors")
+	flags.StringVar(&showOut, "show-out", "",
+		"write shown results that aren't valid to this file (implies --show all unless given)")
+}
+
+// checkShow works out which statuses are shown from --show, --invert and
+// --show-out
+func checkShow() error {
+	switch {
+	case invert && show != nil:
+		return configError(errors.New("--invert and --show can't be used together"))
+	case invert:
+		show = []string{"invalid", "errors"}
+	case show == nil && showOut != "":
+		show = []string{"all"}
+	case show == nil:
+		show = []string{"valid"}
+	}
+
+	shown = make(map[keyhack.Status]bool)
+	for _, s := range show {
+		switch s {
+		case "valid":
+			shown[keyhack.StatusValid] = true
+		case "invalid":
+			shown[keyhack.StatusInvalid] = true
+		case "errors", "unknown":
+			shown[keyhack.StatusUnknown] = true
+		case "all":
+			shown[keyhack.StatusValid] = true
+			shown[keyhack.StatusInvalid] = true
+			shown[keyhack.StatusUnknown] = true
+		default:
+			return configError(fmt.Errorf("--show: unknown status %q, want valid, invalid, errors or all", s))
+		}
+	}
+	return nil
+}
+
+// showsInvalid reports whether results other than valid ones are shown
+func showsInvalid() bool {
+	return shown[keyhack.StatusInvalid] || shown[keyhack.StatusUnknown]
+}
+
+// splitWriter writes valid results to one writer and the rest to a file
+type splitWriter struct {
+	valid resultWriter
+	rest  resultWriter
+	file  *os.File
+}
+
+func (s *splitWriter) Write(result keyhack.Result) error {
+	if result.Status == keyhack.StatusValid {
+		return s.valid.Write(result)
+	}
+	return s.rest.Write(result)
+}
+
+func (s *splitWriter) Close() error {
+	return errors.Join(s.valid.Close(), s.rest.Close(), s.file.Close())
+}
@@ -0,0 +1,20 @@
+package cli
+
+import (
+	"github.com/audibleblink/kh/pkg/keyhack"
+)
+
+// transport holds the HTTP options given on the command line
+var transport keyhack.TransportOptions
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&transport.Proxy, "proxy", "",
+		"route requests through an http(s):// or socks5:// proxy (default $HTTPS_PROXY)")
+	flags.StringVar(&transport.CAFile, "ca-cert", "",
+		"PEM bundle of additional trusted certificates, e.g. an intercepting proxy's")
+	flags.BoolVar(&transport.Insecure, "insecure", false,
+		"skip TLS certificate verification")
+	flags.StringVar(&transport.UserAgent, "user-agent", keyhack.DefaultUserAgent,
+		"User-Agent sent with every request")
+}
@@ -0,0 +1,158 @@
+package keyhack
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Confidence levels reported by Detect
+const (
+	// ConfidenceExact means the token matches the service's pattern and
+	// starts with one of its prefixes
+	ConfidenceExact = 1.0
+	// ConfidencePattern means the token matches the pattern of a service
+	// that declares no prefixes
+	ConfidencePattern = 0.9
+	// ConfidencePatternOnly means the token matches the pattern but none of
+	// the declared prefixes
+	ConfidencePatternOnly = 0.7
+	// ConfidencePrefix means the token starts with a prefix of a service
+	// that declares no pattern
+	ConfidencePrefix = 0.6
+	// ConfidencePrefixOnly means the token starts with a prefix of the
+	// service but doesn't match its pattern
+	ConfidencePrefixOnly = 0.3
+)
+
+// Candidate is a service a token may belong to
+type Candidate struct {
+	Service    string  `json:"service"`
+	Confidence float64 `json:"confidence"`
+}
+
+// patterns caches compiled service patterns by their source
+var patterns sync.Map
+
+// compilePattern compiles a pattern once, anchored if whole is set
+func compilePattern(pattern string, whole bool) (*regexp.Regexp, error) {
+	if whole {
+		pattern = `^(?:` + pattern + `)$`
+	}
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+// Confidence rates how likely the token is to belong to the service, from
+// its Pattern and Prefixes, without sending anything. The pattern must match
+// the whole token. Zero means the service has nothing to say for it.
+func (kh *KeyHack) Confidence(token string) (float64, error) {
+	prefixed := slices.ContainsFunc(kh.Prefixes, func(prefix string) bool {
+		return strings.HasPrefix(token, prefix)
+	})
+
+	if kh.Pattern == "" {
+		if prefixed {
+			return ConfidencePrefix, nil
+		}
+		return 0, nil
+	}
+
+	re, err := compilePattern(kh.Pattern, true)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pattern for %q: %w", kh.Name, err)
+	}
+
+	switch matched := re.MatchString(token); {
+	case matched && prefixed:
+		return ConfidenceExact, nil
+	case matched && len(kh.Prefixes) == 0:
+		return ConfidencePattern, nil
+	case matched:
+		return ConfidencePatternOnly, nil
+	case prefixed:
+		return ConfidencePrefixOnly, nil
+	default:
+		return 0, nil
+	}
+}
+
+// FindAll returns the start and end offsets of every match of the service's
+// pattern in s, which may hold other text around them. Matches must stand on
+// their own: a letter, digit, _ or - right before or after one means it is
+// part of a longer string, so it is skipped. A service without a pattern
+// matches nothing.
+func (kh *KeyHack) FindAll(s string) ([][]int, error) {
+	if kh.Pattern == "" {
+		return nil, nil
+	}
+
+	re, err := compilePattern(kh.Pattern, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern for %q: %w", kh.Name, err)
+	}
+
+	var matches [][]int
+	for pos := 0; pos < len(s); {
+		loc := re.FindStringIndex(s[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+
+		if end > start && !tokenByte(s, start-1) && !tokenByte(s, end) {
+			matches = append(matches, []int{start, end})
+			pos = end
+			continue
+		}
+
+		// A shorter match may still start further in
+		_, size := utf8.DecodeRuneInString(s[start:])
+		pos = start + max(size, 1)
+	}
+	return matches, nil
+}
+
+// tokenByte reports whether s[i] could be part of a token, which is false
+// outside of s
+func tokenByte(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return false
+	}
+	switch c := s[i]; {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '_', c == '-':
+		return true
+	}
+	return false
+}
+
+// Detect returns the services the token may belong to, most likely first
+func Detect(services []*KeyHack, token string) ([]Candidate, error) {
+	var candidates []Candidate
+	for _, service := range services {
+		confidence, err := service.Confidence(token)
+		if err != nil {
+			return nil, err
+		}
+		if confidence > 0 {
+			candidates = append(candidates, Candidate{service.Name, confidence})
+		}
+	}
+
+	slices.SortStableFunc(candidates, func(a, b Candidate) int {
+		return cmp.Or(cmp.Compare(b.Confidence, a.Confidence), cmp.Compare(a.Service, b.Service))
+	})
+	return candidates, nil
+}
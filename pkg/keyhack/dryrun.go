@@ -0,0 +1,74 @@
+package keyhack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Prepare fills in the service's request templates for the token without
+// sending anything. With redact set, the credential is masked wherever it
+// appears in the request; see Mask.
+func (kh *KeyHack) Prepare(token string, redact bool) (*Request, error) {
+	req, err := kh.prepareRequest(token)
+	if err != nil || !redact {
+		return req, err
+	}
+
+	req.redact(kh.redactor(token))
+	return req, nil
+}
+
+// Curl renders the request as a curl command line
+func (req *Request) Curl() (string, error) {
+	httpReq, err := req.httpRequest(context.Background())
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"curl"}
+	if httpReq.Method != "GET" {
+		args = append(args, "-X", httpReq.Method)
+	}
+	for _, k := range slices.Sorted(maps.Keys(httpReq.Header)) {
+		for _, v := range httpReq.Header[k] {
+			args = append(args, "-H", shellQuote(k+": "+v))
+		}
+	}
+	if req.Body != nil && req.Body.Raw != "" {
+		args = append(args, "--data-raw", shellQuote(req.Body.Raw))
+	}
+	args = append(args, shellQuote(req.URL))
+
+	return strings.Join(args, " "), nil
+}
+
+// HTTP renders the request as it goes over the wire, with credentials from
+// the URL moved to an Authorization header as the client does, and line
+// endings shown as plain newlines
+func (req *Request) HTTP() (string, error) {
+	httpReq, err := req.httpRequest(context.Background())
+	if err != nil {
+		return "", err
+	}
+
+	if user := httpReq.URL.User; user != nil {
+		password, _ := user.Password()
+		httpReq.SetBasicAuth(user.Username(), password)
+		httpReq.URL.User = nil
+	}
+
+	var buf bytes.Buffer
+	if err := httpReq.Write(&buf); err != nil {
+		return "", fmt.Errorf("failed to write request: %w", err)
+	}
+	return strings.ReplaceAll(buf.String(), "\r\n", "\n"), nil
+}
+
+// shellQuote single-quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,101 @@
+package keyhack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Extractor pulls one piece of metadata, such as the account or scopes a
+// token belongs to, out of a validation response. Exactly one of JSON,
+// Header or Regex is set.
+type Extractor struct {
+	// JSON is a dotted path into a JSON response body, optionally starting
+	// with "$.", such as "$.user.emails.0"
+	JSON string `yaml:"json,omitempty"`
+
+	// Header names a response header whose values are joined with ", "
+	Header string `yaml:",omitempty"`
+
+	// Regex is matched against the body; the first capture group is the
+	// value, or the whole match if there is none
+	Regex string `yaml:",omitempty"`
+}
+
+// extract applies every extractor to the response. Values that aren't found
+// are left out.
+func extract(extractors map[string]Extractor, resp *http.Response) (map[string]string, error) {
+	if len(extractors) == 0 {
+		return nil, nil
+	}
+
+	body, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the body once, and only if something needs it
+	var doc any
+	var parseErr error
+	parsed := false
+
+	values := make(map[string]string, len(extractors))
+	for name, e := range extractors {
+		var (
+			value string
+			found bool
+		)
+
+		switch {
+		case e.JSON != "" && e.Header == "" && e.Regex == "":
+			if !parsed {
+				parseErr = json.Unmarshal(body, &doc)
+				parsed = true
+			}
+			if parseErr != nil {
+				continue
+			}
+			path := strings.TrimPrefix(strings.TrimPrefix(e.JSON, "$"), ".")
+			if v, ok := lookupJSON(doc, path); ok {
+				value, found = jsonString(v), true
+			}
+
+		case e.Header != "" && e.JSON == "" && e.Regex == "":
+			header := resp.Header.Values(e.Header)
+			value, found = strings.Join(header, ", "), len(header) > 0
+
+		case e.Regex != "" && e.JSON == "" && e.Header == "":
+			re, err := regexp.Compile(e.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("extract %q: invalid regex: %w", name, err)
+			}
+			if m := re.FindSubmatch(body); m != nil {
+				value, found = string(m[min(1, len(m)-1)]), true
+			}
+
+		default:
+			return nil, fmt.Errorf("extract %q: set exactly one of json, header or regex", name)
+		}
+
+		if found {
+			values[name] = value
+		}
+	}
+
+	return values, nil
+}
+
+// jsonString formats a decoded JSON value as metadata: strings as they are,
+// everything else as JSON
+func jsonString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(raw)
+}
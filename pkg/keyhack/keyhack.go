@@ -2,13 +2,18 @@ package keyhack
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"maps"
+	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
 
+// DefaultTimeout bounds each request to services that don't set their own
+var DefaultTimeout = 10 * time.Second
+
 // Registry provides access to the service registry
 var Registry struct {
 	GetService func(name string) (*KeyHack, bool)
@@ -16,12 +21,18 @@ var Registry struct {
 
 // Check validates a token against the specified service
 func Check(serviceName, token string) (bool, error) {
+	return CheckContext(context.Background(), serviceName, token)
+}
+
+// CheckContext validates a token against the specified service, giving up
+// when ctx is done
+func CheckContext(ctx context.Context, serviceName, token string) (bool, error) {
 	service, exists := Registry.GetService(serviceName)
 	if !exists {
 		return false, fmt.Errorf("service %q not configured", serviceName)
 	}
 
-	ok, err := service.Validate(token)
+	ok, err := service.ValidateContext(ctx, token)
 	if err != nil {
 		return false, fmt.Errorf("validation for service %q failed: %w", serviceName, err)
 	}
@@ -33,52 +44,115 @@ func Check(serviceName, token string) (bool, error) {
 // authenticated HTTP response looks like from a given service
 type ValidatorFunc func(*http.Response) (bool, error)
 
-// Validator holds validation configuration and logic for a service
+// Validator holds validation configuration and logic for a service.
+//
+// Unless Custom is set, a response is judged by the declarative rules below.
+// Each configured rule contributes one check, and Match decides whether all
+// (the default) or any of them must pass. With no rules configured, a 200 OK
+// is considered valid.
 type Validator struct {
-	Custom bool
-	Status int
-	Fn     ValidatorFunc
+	Custom bool          `yaml:",omitempty"`
+	Fn     ValidatorFunc `yaml:"-"`
+
+	// Status and Statuses list the HTTP status codes accepted as valid
+	Status   int   `yaml:",omitempty"`
+	Statuses []int `yaml:",omitempty"`
+
+	// RequiredHeaders maps response headers that must be present to an
+	// optional regular expression one of their values must match
+	RequiredHeaders map[string]string `yaml:"required_headers,omitempty"`
+
+	// ForbiddenHeaders lists response headers that must not be present
+	ForbiddenHeaders []string `yaml:"forbidden_headers,omitempty"`
+
+	// BodyRegex is a regular expression the response body must match
+	BodyRegex string `yaml:"body_regex,omitempty"`
+
+	// JSON maps dotted paths into a JSON response body to expected values
+	JSON map[string]any `yaml:"json,omitempty"`
+
+	// Match is either "all" or "any"
+	Match string `yaml:",omitempty"`
 }
 
 // Request contains the necessary parameters for validating a token
 type Request struct {
-	Method  string
-	URL     string
-	Headers map[string]string
+	Method  string            `yaml:",omitempty"`
+	URL     string            `yaml:",omitempty"`
+	Headers map[string]string `yaml:",omitempty"`
+	Body    *Body             `yaml:",omitempty"`
+}
+
+// Body is the payload of a validation request. Exactly one of Raw, Form or
+// JSON is set; templates are filled in Raw, the Form values and every string
+// in JSON.
+type Body struct {
+	Raw  string            `yaml:",omitempty"`
+	Form map[string]string `yaml:",omitempty"`
+	JSON any               `yaml:"json,omitempty"`
+
+	// ContentType is sent with Raw bodies; Form and JSON bodies set their own
+	ContentType string `yaml:"content_type,omitempty"`
 }
 
 // KeyHack represents an API service definition from the config YAML
 type KeyHack struct {
-	Name string
-	Request
-	Validator
-	Custom bool
+	Name        string `yaml:",omitempty"`
+	Description string `yaml:",omitempty"`
+
+	// Placeholder describes the shape of the expected credential, such as
+	// <token> or <client_id:client_secret>
+	Placeholder string `yaml:"token,omitempty"`
+
+	// Credential declares how the input is split into named template fields
+	Credential Credential `yaml:",omitempty"`
+
+	// Pattern is a regular expression describing the service's tokens, and
+	// Prefixes are strings they start with; both are used to guess which
+	// service a token belongs to
+	Pattern  string   `yaml:",omitempty"`
+	Prefixes []string `yaml:",omitempty"`
+
+	// Rules maps secret scanners, such as gitleaks or trufflehog, to the
+	// rule or detector IDs whose findings belong to the service
+	Rules map[string][]string `yaml:",omitempty"`
+
+	// RateLimit caps how fast requests are sent to the service
+	RateLimit RateLimit `yaml:"rate_limit,omitempty"`
+
+	// Timeout bounds each request to the service, overriding DefaultTimeout
+	Timeout time.Duration `yaml:",omitempty"`
+
+	Request   `yaml:",omitempty"`
+	Validator `yaml:",omitempty"`
+
+	// Extract names metadata to pull out of the responses to valid tokens
+	Extract map[string]Extractor `yaml:",omitempty"`
+
+	// Sources lists the config files that defined or overrode the service,
+	// lowest precedence first
+	Sources []string `yaml:"-"`
 }
 
-// Validate sends an HTTP request with the given token and validates the response
+// Validate sends an HTTP request with the given token and validates the
+// response. An error is returned when no verdict could be reached; see Verify
+// for the reason behind it.
 func (kh *KeyHack) Validate(token string) (bool, error) {
-	// Fill in the token template
-	req := kh.prepareRequest(token)
-
-	// Send the request
-	res, err := kh.sendRequest(req)
-	if err != nil {
-		return false, fmt.Errorf("validation request failed: %w", err)
-	}
-	defer res.Body.Close()
+	return kh.ValidateContext(context.Background(), token)
+}
 
-	// Use default validator if none provided
-	if !kh.Custom {
-		kh.Fn = defaultValidator
-	}
+// ValidateContext is Validate, giving up when ctx is done
+func (kh *KeyHack) ValidateContext(ctx context.Context, token string) (bool, error) {
+	result := kh.VerifyContext(ctx, token)
+	return result.Status == StatusValid, result.Err
+}
 
-	// Run the validator
-	ok, err := kh.Fn(res)
-	if err != nil {
-		return false, fmt.Errorf("validator function failed: %w", err)
+// timeout returns how long a single request to the service may take
+func (kh *KeyHack) timeout() time.Duration {
+	if kh.Timeout > 0 {
+		return kh.Timeout
 	}
-
-	return ok, nil
+	return DefaultTimeout
 }
 
 // defaultValidator checks for HTTP 200 OK status code
@@ -86,58 +160,160 @@ func defaultValidator(resp *http.Response) (bool, error) {
 	return resp.StatusCode == 200, nil
 }
 
-// prepareRequest creates a Request with the token inserted in templates
-func (kh *KeyHack) prepareRequest(token string) *Request {
+// prepareRequest creates a Request with the credential's fields inserted in
+// templates. Any body is encoded to its raw form, with the matching
+// Content-Type header.
+func (kh *KeyHack) prepareRequest(token string) (*Request, error) {
+	fields, err := kh.Credential.fields(token)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := fillURL(kh.URL, fields)
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+
 	newReq := &Request{
 		Method:  kh.Method,
-		URL:     kh.URL,
+		URL:     target,
 		Headers: make(map[string]string, len(kh.Headers)),
 	}
 
-	// Copy headers to avoid modifying original
-	maps.Copy(newReq.Headers, kh.Headers)
+	// Fill header templates, copying to avoid modifying the original
+	for k, v := range kh.Headers {
+		value, err := fill(v, fields)
+		if err == nil {
+			err = checkHeader(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("header %q: %w", k, err)
+		}
+		newReq.Headers[k] = value
+	}
 
-	// Fill URL template
-	if strings.Contains(kh.URL, "%s") {
-		newReq.URL = fmt.Sprintf(kh.URL, token)
+	if kh.Body == nil {
+		return newReq, nil
 	}
 
-	// Fill header templates
-	for k, v := range kh.Headers {
-		if strings.Contains(v, "%s") {
-			newReq.Headers[k] = fmt.Sprintf(v, token)
-		}
+	body, err := kh.Body.render(fields)
+	if err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+	newReq.Body = body
+
+	// Headers from the config win over the derived Content-Type
+	if body.ContentType != "" && !hasHeader(newReq.Headers, "Content-Type") {
+		newReq.Headers["Content-Type"] = body.ContentType
 	}
 
-	return newReq
+	return newReq, nil
 }
 
-// sendRequest performs the HTTP request and returns the response
-func (kh *KeyHack) sendRequest(req *Request) (*http.Response, error) {
-	// Create a context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// render encodes the body with its templates filled, returning it as a raw
+// body along with its content type
+func (b *Body) render(fields map[string]string) (*Body, error) {
+	set := 0
+	for _, ok := range []bool{b.Raw != "", b.Form != nil, b.JSON != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, fmt.Errorf("body must set only one of raw, form or json")
+	}
 
-	// Build the HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	switch {
+	case b.Form != nil:
+		form := make(url.Values, len(b.Form))
+		for k, v := range b.Form {
+			value, err := fill(v, fields)
+			if err != nil {
+				return nil, err
+			}
+			form.Set(k, value)
+		}
+		return &Body{
+			Raw:         form.Encode(),
+			ContentType: "application/x-www-form-urlencoded",
+		}, nil
+
+	case b.JSON != nil:
+		doc, err := fillJSON(b.JSON, fields)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode JSON body: %w", err)
+		}
+		return &Body{
+			Raw:         string(raw),
+			ContentType: "application/json",
+		}, nil
+
+	default:
+		raw, err := fill(b.Raw, fields)
+		if err != nil {
+			return nil, err
+		}
+		return &Body{
+			Raw:         raw,
+			ContentType: b.ContentType,
+		}, nil
 	}
+}
 
-	// Add headers
-	for k, v := range req.Headers {
-		httpReq.Header.Add(k, v)
+// hasHeader reports whether headers contains name, ignoring case
+func hasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
 	}
+	return false
+}
 
-	// Send the request
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+// sendRequest performs the HTTP request and returns the response. The body
+// is read up front, so the response outlives ctx.
+func (kh *KeyHack) sendRequest(ctx context.Context, req *Request) (*http.Response, error) {
+	httpReq, err := req.httpRequest(ctx)
+	if err != nil {
+		return nil, err
 	}
 
+	// Send the request over the shared client; ctx carries the timeout
 	res, err := client.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute request: %w", err)
 	}
+	defer res.Body.Close()
+
+	if _, err := readBody(res); err != nil {
+		return nil, err
+	}
 
 	return res, nil
 }
+
+// httpRequest builds the HTTP request as it is sent, User-Agent included
+func (req *Request) httpRequest(ctx context.Context) (*http.Request, error) {
+	var body io.Reader
+	if req.Body != nil {
+		body = strings.NewReader(req.Body.Raw)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for k, v := range req.Headers {
+		httpReq.Header.Add(k, v)
+	}
+	if httpReq.Header.Get("User-Agent") == "" {
+		httpReq.Header.Set("User-Agent", userAgent)
+	}
+
+	return httpReq, nil
+}
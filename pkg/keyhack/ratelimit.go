@@ -0,0 +1,236 @@
+package keyhack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a service keeps rate limiting requests
+var ErrRateLimited = errors.New("rate limited")
+
+// maxRateLimitWait is the longest kh will wait on a service's say-so
+const maxRateLimitWait = time.Minute
+
+// Progress receives notes about requests held back by rate limits
+var Progress io.Writer = io.Discard
+
+// RateLimit configures how fast requests may be sent to a service
+type RateLimit struct {
+	// RPS is the sustained number of requests per second; 0 is unlimited
+	RPS float64 `yaml:"rps,omitempty"`
+
+	// Burst is how many requests may be sent at once, 1 by default
+	Burst int `yaml:",omitempty"`
+}
+
+// limiters holds a limiter per service name, shared by all checks
+var limiters sync.Map
+
+// limiter is a token bucket that can also be paused when a service asks
+// clients to back off
+type limiter struct {
+	mu     sync.Mutex
+	rps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	resume time.Time
+}
+
+// limiterFor returns the service's limiter, creating it on first use
+func limiterFor(kh *KeyHack) *limiter {
+	burst := float64(max(kh.RateLimit.Burst, 1))
+	l, _ := limiters.LoadOrStore(kh.Name, &limiter{
+		rps:    kh.RateLimit.RPS,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	})
+	return l.(*limiter)
+}
+
+// wait blocks until a request may be sent
+func (l *limiter) wait(ctx context.Context) error {
+	for {
+		delay := l.reserve(time.Now())
+		if delay <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token if one is available, or returns how long to wait
+// before trying again
+func (l *limiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.resume) {
+		return l.resume.Sub(now)
+	}
+
+	if l.rps <= 0 {
+		return 0
+	}
+
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rps)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.rps * float64(time.Second))
+}
+
+// pause holds off every request until d, at most maxRateLimitWait, has
+// passed
+func (l *limiter) pause(d time.Duration) {
+	d = min(d, maxRateLimitWait)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.resume) {
+		l.resume = until
+	}
+}
+
+// exchange sends the request once the service's rate limit allows it and
+// returns the response along with the number of requests sent. Transient
+// failures are retried following DefaultRetry, except that a 429 Too Many
+// Requests holds off every request to the service as long as it asks, if
+// it says. A rejection that reports the credential's own quota exhausted,
+// such as GitHub's 403 with X-RateLimit-Remaining: 0, is retried too once
+// the quota resets, but only that request waits. No wait is longer than
+// maxRateLimitWait.
+func (kh *KeyHack) exchange(ctx context.Context, req *Request) (*http.Response, int, error) {
+	l := limiterFor(kh)
+	policy := DefaultRetry
+
+	for attempt := 1; ; attempt++ {
+		if err := l.wait(ctx); err != nil {
+			return nil, attempt - 1, err
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, kh.timeout())
+		res, err := kh.sendRequest(attemptCtx, req)
+		cancel()
+
+		last := attempt > policy.Retries || ctx.Err() != nil
+		if err != nil {
+			if last || !transientError(err) {
+				return nil, attempt, err
+			}
+			if err := sleep(ctx, policy.delay(attempt)); err != nil {
+				return nil, attempt, err
+			}
+			continue
+		}
+
+		delay, limited := rateLimitDelay(res.Header, time.Now())
+		serviceWide := res.StatusCode == http.StatusTooManyRequests || res.Header.Get("Retry-After") != ""
+		switch {
+		case serviceWide && res.StatusCode >= 400:
+			if !limited {
+				delay = policy.delay(attempt)
+			}
+			if last || delay > maxRateLimitWait {
+				return nil, attempt, fmt.Errorf("%w: gave up after %d attempts", ErrRateLimited, attempt)
+			}
+			kh.waiting(delay)
+			l.pause(delay)
+
+		case limited && res.StatusCode >= 400:
+			// The quota of this credential is exhausted, such as GitHub's 403
+			// with X-RateLimit-Remaining: 0. Other credentials have their own,
+			// so only this request waits.
+			if last || delay > maxRateLimitWait {
+				return nil, attempt, fmt.Errorf("%w: gave up after %d attempts", ErrRateLimited, attempt)
+			}
+			kh.waiting(delay)
+			if err := sleep(ctx, delay); err != nil {
+				return nil, attempt, err
+			}
+
+		case res.StatusCode >= 500 && !last:
+			if err := sleep(ctx, policy.delay(attempt)); err != nil {
+				return nil, attempt, err
+			}
+
+		default:
+			// Accepted, but the service asks to hold off the next request
+			if serviceWide && limited {
+				kh.waiting(min(delay, maxRateLimitWait))
+				l.pause(delay)
+			}
+			return res, attempt, nil
+		}
+	}
+}
+
+// waiting reports on Progress that requests to the service are held back
+// for d, unless the wait is too short to notice
+func (kh *KeyHack) waiting(d time.Duration) {
+	if d >= time.Second {
+		fmt.Fprintf(Progress, "Warning: %s is rate limited, waiting %s\n", kh.Name, d.Round(time.Second))
+	}
+}
+
+// rateLimitDelay reads how long a service wants clients to wait from the
+// response headers. It understands Retry-After, the common
+// X-RateLimit-Remaining/X-RateLimit-Reset pair, and Discord's
+// X-RateLimit-Reset-After.
+func rateLimitDelay(header http.Header, now time.Time) (time.Duration, bool) {
+	if v := header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil {
+			return seconds(secs), true
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			return max(at.Sub(now), 0), true
+		}
+	}
+
+	if header.Get("X-RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+
+	// Discord sends the delay relative to now, alongside its bucket headers
+	if v := header.Get("X-RateLimit-Reset-After"); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil {
+			return seconds(secs), true
+		}
+	}
+
+	// Reset is usually a Unix timestamp, but some services send the delay
+	if v := header.Get("X-RateLimit-Reset"); v != "" {
+		if reset, err := strconv.ParseFloat(v, 64); err == nil {
+			if reset < 1e9 {
+				return seconds(reset), true
+			}
+			at := time.Unix(0, int64(reset*float64(time.Second)))
+			return max(at.Sub(now), 0), true
+		}
+	}
+
+	return 0, false
+}
+
+// seconds converts a possibly fractional number of seconds to a duration
+func seconds(secs float64) time.Duration {
+	return time.Duration(max(secs, 0) * float64(time.Second))
+}
@@ -0,0 +1,91 @@
+package keyhack
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Redact masks credentials in the errors and metadata of results, and in
+// requests prepared for display
+var Redact = true
+
+// minRedactLen is the shortest credential part that is masked. Shorter parts
+// can't be told apart from the text around them, such as "app" in
+// "application/json".
+const minRedactLen = 4
+
+// Mask hides all but a few characters at each end of a secret, so that it can
+// still be recognised. The length of the secret isn't revealed.
+func Mask(secret string) string {
+	r := []rune(secret)
+	keep := min(len(r)/4, 4)
+	return string(r[:keep]) + "****" + string(r[len(r)-keep:])
+}
+
+// redactor masks the credential and each of its fields wherever they appear
+// in text, including the forms they take once escaped for a URL or JSON
+func (kh *KeyHack) redactor(token string) *strings.Replacer {
+	values := []string{token}
+	if fields, err := kh.Credential.fields(token); err == nil {
+		for _, name := range kh.Credential.Fields {
+			values = append(values, fields[name])
+		}
+	}
+
+	type secret struct{ text, mask string }
+	var secrets []secret
+	for _, v := range values {
+		if len(v) < minRedactLen {
+			continue
+		}
+		mask := Mask(v)
+		forms := []string{v, url.QueryEscape(v), url.PathEscape(v), url.User(v).String()}
+		if raw, err := json.Marshal(v); err == nil {
+			forms = append(forms, string(raw[1:len(raw)-1]))
+		}
+		for _, form := range forms {
+			secrets = append(secrets, secret{form, mask})
+		}
+	}
+
+	// Longest first, so that the whole credential is masked before its parts
+	slices.SortStableFunc(secrets, func(a, b secret) int { return cmp.Compare(len(b.text), len(a.text)) })
+	pairs := make([]string, 0, len(secrets)*2)
+	for _, s := range secrets {
+		pairs = append(pairs, s.text, s.mask)
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// redact masks the credential in the request's URL, headers and body
+func (req *Request) redact(r *strings.Replacer) {
+	req.URL = r.Replace(req.URL)
+	for k, v := range req.Headers {
+		req.Headers[k] = r.Replace(v)
+	}
+	if req.Body != nil {
+		req.Body.Raw = r.Replace(req.Body.Raw)
+	}
+}
+
+// redactedError masks the credential in an error's message while keeping the
+// error itself available to errors.Is and errors.As
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactError returns err with the credential masked in its message
+func redactError(err error, r *strings.Replacer) error {
+	msg := err.Error()
+	if masked := r.Replace(msg); masked != msg {
+		return &redactedError{err: err, msg: masked}
+	}
+	return err
+}
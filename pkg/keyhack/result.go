@@ -0,0 +1,209 @@
+package keyhack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrMalformed is returned when a credential can't possibly be valid for a
+// service, such as one missing a declared part
+var ErrMalformed = errors.New("malformed credential")
+
+// Status is the verdict on a token
+type Status int
+
+const (
+	// StatusUnknown means no verdict could be reached, see Result.Reason
+	StatusUnknown Status = iota
+	// StatusValid means the service accepted the token
+	StatusValid
+	// StatusInvalid means the service rejected the token
+	StatusInvalid
+)
+
+// String returns the lowercase name of the status
+func (s Status) String() string {
+	switch s {
+	case StatusValid:
+		return "valid"
+	case StatusInvalid:
+		return "invalid"
+	default:
+		return "unknown"
+	}
+}
+
+// Result is the outcome of checking a token against a service
+type Result struct {
+	Service string
+	Token   string
+	Status  Status
+
+	// Reason briefly explains the status, such as "http 401" or "timeout"
+	Reason string
+
+	// HTTPStatus is the status code of the last response, if one arrived
+	HTTPStatus int
+
+	// Metadata holds the values extracted from the response to a valid
+	// token, such as the account it belongs to and its scopes
+	Metadata map[string]string
+
+	// Attempts is how many requests were sent, counting retries
+	Attempts int
+
+	// Latency is how long the check took, including any waiting on rate
+	// limits
+	Latency time.Duration
+
+	// Err is the error behind an unknown result
+	Err error
+}
+
+// Verify checks a token against the specified service
+func Verify(serviceName, token string) Result {
+	return VerifyContext(context.Background(), serviceName, token)
+}
+
+// VerifyContext checks a token against the specified service, giving up
+// when ctx is done
+func VerifyContext(ctx context.Context, serviceName, token string) Result {
+	service, exists := Registry.GetService(serviceName)
+	if !exists {
+		return Result{
+			Service: serviceName,
+			Token:   token,
+			Reason:  "not configured",
+			Err:     fmt.Errorf("service %q not configured", serviceName),
+		}
+	}
+
+	return service.VerifyContext(ctx, token)
+}
+
+// Verify sends an HTTP request with the given token and reports the verdict
+// on the response. Only responses that clearly reject the token are invalid;
+// server errors, rate limiting and network failures are unknown.
+func (kh *KeyHack) Verify(token string) Result {
+	return kh.VerifyContext(context.Background(), token)
+}
+
+// VerifyContext is Verify, giving up when ctx is done
+func (kh *KeyHack) VerifyContext(ctx context.Context, token string) (result Result) {
+	start := time.Now()
+	result = Result{Service: kh.Name, Token: token}
+	defer func() {
+		result.Latency = time.Since(start)
+		if Redact {
+			result.redact(kh.redactor(token))
+		}
+	}()
+
+	// Fill in the token template
+	req, err := kh.prepareRequest(token)
+	if errors.Is(err, ErrMalformed) {
+		return result.unknown("bad input", err)
+	}
+	if err != nil {
+		return result.unknown("bad config", fmt.Errorf("failed to prepare request: %w", err))
+	}
+
+	// Send the request
+	res, attempts, err := kh.exchange(ctx, req)
+	result.Attempts = attempts
+	if err != nil {
+		return result.unknown(failureReason(err), fmt.Errorf("validation request failed: %w", err))
+	}
+	defer res.Body.Close()
+	result.HTTPStatus = res.StatusCode
+
+	// Custom validators are registered from Go, everything else is declared
+	// in the config
+	validate := kh.Validator.Evaluate
+	if kh.Validator.Custom {
+		if kh.Fn == nil {
+			return result.unknown("bad config", fmt.Errorf("no custom validator registered for %q", kh.Name))
+		}
+		validate = kh.Fn
+	}
+
+	// Run the validator
+	ok, err := validate(res)
+	if err != nil {
+		return result.unknown("validator error", fmt.Errorf("validator function failed: %w", err))
+	}
+
+	switch {
+	case ok:
+		metadata, err := extract(kh.Extract, res)
+		if err != nil {
+			return result.unknown("bad config", fmt.Errorf("failed to extract metadata: %w", err))
+		}
+		result.Status = StatusValid
+		result.Metadata = metadata
+	case res.StatusCode == http.StatusTooManyRequests:
+		return result.unknown("rate limited", ErrRateLimited)
+	case res.StatusCode >= 500:
+		return result.unknown(httpReason(res.StatusCode), fmt.Errorf("server error: %s", res.Status))
+	default:
+		result.Status = StatusInvalid
+	}
+	result.Reason = httpReason(res.StatusCode)
+
+	return result
+}
+
+// unknown marks the result as unknown for the given reason
+func (r Result) unknown(reason string, err error) Result {
+	r.Status = StatusUnknown
+	r.Reason = reason
+	r.Err = err
+	return r
+}
+
+// redact masks the credential in the error and metadata of the result
+func (r *Result) redact(replacer *strings.Replacer) {
+	if r.Err != nil {
+		r.Err = redactError(r.Err, replacer)
+	}
+	for k, v := range r.Metadata {
+		r.Metadata[k] = replacer.Replace(v)
+	}
+}
+
+// httpReason describes an HTTP status code
+func httpReason(code int) string {
+	return fmt.Sprintf("http %d", code)
+}
+
+// failureReason classifies the error of a request that got no response
+func failureReason(err error) string {
+	var (
+		dnsErr *net.DNSError
+		netErr net.Error
+	)
+
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		return "rate limited"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &dnsErr):
+		return "dns failure"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection reset"
+	default:
+		return "request failed"
+	}
+}
@@ -0,0 +1,87 @@
+package keyhack
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides how often and how patiently requests that failed for
+// a transient reason are sent again
+type RetryPolicy struct {
+	// Retries is how many times a request is retried after the first attempt
+	Retries int
+
+	// Backoff is the delay before the first retry; it doubles with every
+	// retry after that, up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter randomises each delay by up to this fraction either way, so
+	// that concurrent retries spread out
+	Jitter float64
+}
+
+// DefaultRetry applies to every service
+var DefaultRetry = RetryPolicy{
+	Retries:    2,
+	Backoff:    500 * time.Millisecond,
+	MaxBackoff: 30 * time.Second,
+	Jitter:     0.2,
+}
+
+// delay returns how long to wait before the given retry, counting from 1
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 {
+		d = min(d, p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+	return max(d, 0)
+}
+
+// transientError reports whether a request that got no response is worth
+// retrying. Dropped connections and timeouts are; DNS failures, refused
+// connections and TLS errors won't fix themselves in a few seconds.
+func transientError(err error) bool {
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrRateLimited):
+		return false
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	case errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for d, returning early with an error when ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,256 @@
+package keyhack
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// TokenField is the template field that always holds the whole credential
+const TokenField = "token"
+
+// DefaultSeparator splits multi-part credentials when none is configured
+const DefaultSeparator = ":"
+
+// Credential declares how an input credential is split into named fields
+// for templates such as {{.id}} and {{.secret}}. The whole input is always
+// available as {{.token}}.
+type Credential struct {
+	// Fields names the parts of the credential, in order. The last field
+	// receives the remainder, so it may contain the separator.
+	Fields []string `yaml:",omitempty"`
+
+	// Separator sits between the parts, ":" by default
+	Separator string `yaml:",omitempty"`
+}
+
+// separator returns the configured separator or the default
+func (c Credential) separator() string {
+	if c.Separator == "" {
+		return DefaultSeparator
+	}
+	return c.Separator
+}
+
+// Shape describes the expected credential, such as <id:secret>
+func (c Credential) Shape() string {
+	if len(c.Fields) == 0 {
+		return "<" + TokenField + ">"
+	}
+	return "<" + strings.Join(c.Fields, c.separator()) + ">"
+}
+
+// fields splits a credential into the template fields it declares
+func (c Credential) fields(token string) (map[string]string, error) {
+	fields := map[string]string{TokenField: token}
+	if len(c.Fields) == 0 {
+		return fields, nil
+	}
+
+	if slices.Contains(c.Fields, TokenField) {
+		return nil, fmt.Errorf("credential field %q is reserved for the whole input", TokenField)
+	}
+
+	parts := strings.SplitN(token, c.separator(), len(c.Fields))
+	if len(parts) != len(c.Fields) || slices.Contains(parts, "") {
+		return nil, fmt.Errorf("%w: must have the form %s", ErrMalformed, c.Shape())
+	}
+
+	for i, name := range c.Fields {
+		fields[name] = parts[i]
+	}
+
+	return fields, nil
+}
+
+// fill executes a template against the credential's fields. A bare %s, the
+// original placeholder syntax, stands for {{.token}}.
+func fill(tmpl string, fields map[string]string) (string, error) {
+	if strings.Contains(tmpl, "%s") {
+		tmpl = strings.ReplaceAll(tmpl, "%s", "{{."+TokenField+"}}")
+	}
+	if !strings.Contains(tmpl, "{{") {
+		return tmpl, nil
+	}
+
+	t, err := template.New("").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
+	}
+
+	var out strings.Builder
+	if err := t.Execute(&out, fields); err != nil {
+		return "", fmt.Errorf("failed to fill template: %w", err)
+	}
+
+	return out.String(), nil
+}
+
+// urlPart is a position within a URL that calls for its own escaping
+type urlPart int
+
+const (
+	partScheme urlPart = iota
+	partUserinfo
+	partHost
+	partPath
+	partQuery
+	partFragment
+)
+
+// Markers stand in for field values while the URL template is analysed.
+// They come from the Unicode private use area, so they can't be mistaken for
+// URL syntax.
+const (
+	markerStart = '\ue000'
+	markerEnd   = '\ue001'
+)
+
+// fillURL fills a URL template, escaping each value according to where it
+// lands: userinfo, host, path, query or fragment. Values can therefore never
+// change the structure of the URL, such as its host.
+func fillURL(tmpl string, fields map[string]string) (string, error) {
+	// Render with markers in place of the values, so that the URL's own
+	// syntax can be told apart from what the credential contributes
+	names := slices.Sorted(maps.Keys(fields))
+	markers := make(map[string]string, len(fields))
+	for i, name := range names {
+		markers[name] = string(markerStart) + strconv.Itoa(i) + string(markerEnd)
+	}
+
+	skeleton, err := fill(tmpl, markers)
+	if err != nil {
+		return "", err
+	}
+
+	// The authority runs from "://" to the first of "/?#", and its last "@"
+	// separates userinfo from host
+	authStart, authEnd, userinfoEnd := -1, -1, -1
+	if i := strings.Index(skeleton, "://"); i >= 0 {
+		authStart = i + len("://")
+		authEnd = len(skeleton)
+		if j := strings.IndexAny(skeleton[authStart:], "/?#"); j >= 0 {
+			authEnd = authStart + j
+		}
+		if j := strings.LastIndex(skeleton[authStart:authEnd], "@"); j >= 0 {
+			userinfoEnd = authStart + j
+		}
+	}
+
+	var out strings.Builder
+	part := partPath
+	if authStart >= 0 {
+		part = partScheme
+	}
+
+	for i := 0; i < len(skeleton); {
+		switch {
+		case i == authStart && userinfoEnd >= 0:
+			part = partUserinfo
+		case i == authStart || i == userinfoEnd:
+			part = partHost
+		case i == authEnd && part != partPath:
+			part = partPath
+		}
+
+		c := skeleton[i]
+		switch {
+		case c == '?' && part == partPath:
+			part = partQuery
+		case c == '#' && (part == partPath || part == partQuery):
+			part = partFragment
+		}
+
+		if !strings.HasPrefix(skeleton[i:], string(markerStart)) {
+			out.WriteByte(c)
+			i++
+			continue
+		}
+
+		// Swap the marker for the escaped value
+		end := strings.IndexRune(skeleton[i:], markerEnd)
+		if end < 0 {
+			return "", fmt.Errorf("malformed template")
+		}
+		idx, err := strconv.Atoi(skeleton[i+len(string(markerStart)) : i+end])
+		if err != nil || idx >= len(names) {
+			return "", fmt.Errorf("malformed template")
+		}
+		name := names[idx]
+
+		escaped, err := escapeURLPart(fields[name], part)
+		if err != nil {
+			return "", fmt.Errorf("field %q: %w", name, err)
+		}
+		out.WriteString(escaped)
+		i += end + len(string(markerEnd))
+	}
+
+	return out.String(), nil
+}
+
+// escapeURLPart escapes a value for the given position in a URL
+func escapeURLPart(value string, part urlPart) (string, error) {
+	switch part {
+	case partScheme:
+		return "", fmt.Errorf("values can't be placed in the URL scheme")
+	case partUserinfo:
+		return url.User(value).String(), nil
+	case partHost:
+		// Only allow what can appear in a single DNS label, so a value can
+		// never move the request to another domain
+		for _, r := range value {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return "", fmt.Errorf("%w: %q is not valid in a host name", ErrMalformed, r)
+			}
+		}
+		return value, nil
+	case partQuery:
+		return url.QueryEscape(value), nil
+	default:
+		return url.PathEscape(value), nil
+	}
+}
+
+// checkHeader rejects header values that could smuggle in extra headers
+func checkHeader(value string) error {
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return fmt.Errorf("%w: header values can't contain CR, LF or NUL", ErrMalformed)
+	}
+	return nil
+}
+
+// fillJSON fills every string of a decoded JSON or YAML document, returning
+// a copy
+func fillJSON(doc any, fields map[string]string) (any, error) {
+	switch node := doc.(type) {
+	case string:
+		return fill(node, fields)
+	case map[string]any:
+		out := make(map[string]any, len(node))
+		for k, v := range node {
+			filled, err := fillJSON(v, fields)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = filled
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(node))
+		for i, v := range node {
+			filled, err := fillJSON(v, fields)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = filled
+		}
+		return out, nil
+	default:
+		return node, nil
+	}
+}
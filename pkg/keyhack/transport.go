@@ -0,0 +1,94 @@
+package keyhack
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// DefaultUserAgent is sent with requests that don't set their own
+const DefaultUserAgent = "kh (+https://github.com/audibleblink/kh)"
+
+// TransportOptions configures the HTTP client shared by every check
+type TransportOptions struct {
+	// Proxy is an http, https, socks5 or socks5h URL. When empty, the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables apply.
+	Proxy string
+
+	// CAFile is a PEM bundle of certificates trusted in addition to the
+	// system roots, such as an intercepting proxy's
+	CAFile string
+
+	// Insecure skips TLS certificate verification
+	Insecure bool
+
+	// UserAgent replaces DefaultUserAgent
+	UserAgent string
+}
+
+var (
+	// client is shared by every check so connections are reused
+	client = &http.Client{Transport: newTransport()}
+
+	// userAgent is sent with requests that don't set their own
+	userAgent = DefaultUserAgent
+)
+
+// Configure replaces the shared HTTP client. It must not be called while
+// checks are running.
+func Configure(opts TransportOptions) error {
+	transport := newTransport()
+
+	if opts.Proxy != "" {
+		proxy, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy: %w", err)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("unsupported proxy scheme %q", proxy.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if opts.CAFile != "" || opts.Insecure {
+		tlsConfig := &tls.Config{InsecureSkipVerify: opts.Insecure}
+
+		if opts.CAFile != "" {
+			pem, err := os.ReadFile(opts.CAFile)
+			if err != nil {
+				return fmt.Errorf("failed to read CA bundle: %w", err)
+			}
+
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("no certificates found in %s", opts.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	client = &http.Client{Transport: transport}
+	userAgent = DefaultUserAgent
+	if opts.UserAgent != "" {
+		userAgent = opts.UserAgent
+	}
+
+	return nil
+}
+
+// newTransport returns a keep-alive transport sized for concurrent checks
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 64
+	return transport
+}
@@ -0,0 +1,168 @@
+package keyhack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Match modes for combining declarative validator rules
+const (
+	MatchAll = "all"
+	MatchAny = "any"
+)
+
+// maxBodySize caps how much of a response body is read for validation
+const maxBodySize = 1 << 20
+
+// Evaluate judges a response against the declarative rules of the validator
+func (v *Validator) Evaluate(resp *http.Response) (bool, error) {
+	checks, err := v.checks(resp)
+	if err != nil {
+		return false, err
+	}
+
+	// Nothing declared, fall back to the 200 OK check
+	if len(checks) == 0 {
+		return defaultValidator(resp)
+	}
+
+	switch v.Match {
+	case "", MatchAll:
+		return !slices.Contains(checks, false), nil
+	case MatchAny:
+		return slices.Contains(checks, true), nil
+	default:
+		return false, fmt.Errorf("unknown match mode %q", v.Match)
+	}
+}
+
+// checks runs every configured rule against the response and returns one
+// result per rule
+func (v *Validator) checks(resp *http.Response) ([]bool, error) {
+	var checks []bool
+
+	if v.Status != 0 || len(v.Statuses) > 0 {
+		ok := resp.StatusCode == v.Status || slices.Contains(v.Statuses, resp.StatusCode)
+		checks = append(checks, ok)
+	}
+
+	for name, pattern := range v.RequiredHeaders {
+		ok, err := matchHeader(resp.Header, name, pattern)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, ok)
+	}
+
+	for _, name := range v.ForbiddenHeaders {
+		checks = append(checks, len(resp.Header.Values(name)) == 0)
+	}
+
+	// Only touch the body when a rule needs it
+	if v.BodyRegex == "" && len(v.JSON) == 0 {
+		return checks, nil
+	}
+
+	body, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.BodyRegex != "" {
+		re, err := regexp.Compile(v.BodyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body_regex: %w", err)
+		}
+		checks = append(checks, re.Match(body))
+	}
+
+	if len(v.JSON) > 0 {
+		var doc any
+		// A body that isn't JSON fails every assertion
+		parseErr := json.Unmarshal(body, &doc)
+		for path, want := range v.JSON {
+			if parseErr != nil {
+				checks = append(checks, false)
+				continue
+			}
+			got, ok := lookupJSON(doc, path)
+			checks = append(checks, ok && jsonEqual(got, want))
+		}
+	}
+
+	return checks, nil
+}
+
+// matchHeader reports whether the header is present and, if a pattern is
+// given, whether any of its values match it
+func matchHeader(header http.Header, name, pattern string) (bool, error) {
+	values := header.Values(name)
+	if pattern == "" || len(values) == 0 {
+		return len(values) > 0, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, fmt.Errorf("invalid pattern for header %q: %w", name, err)
+	}
+
+	return slices.ContainsFunc(values, re.MatchString), nil
+}
+
+// readBody reads the response body and replaces it so that it can be read
+// again by later consumers
+func readBody(resp *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// lookupJSON walks a decoded JSON document along a dotted path such as
+// "user.emails.0"
+func lookupJSON(doc any, path string) (any, bool) {
+	cur := doc
+	for _, key := range strings.Split(path, ".") {
+		switch node := cur.(type) {
+		case map[string]any:
+			next, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			cur = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// jsonEqual compares a decoded JSON value with an expected value from the
+// config by normalising the latter through a JSON round trip
+func jsonEqual(got, want any) bool {
+	raw, err := json.Marshal(want)
+	if err != nil {
+		return false
+	}
+	var norm any
+	if err := json.Unmarshal(raw, &norm); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(got, norm)
+}
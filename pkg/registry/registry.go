@@ -2,12 +2,20 @@ package registry
 
 import (
 	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 
 	kh "github.com/audibleblink/kh/pkg/keyhack"
 )
 
+// EmbeddedSource names the configuration compiled into the binary
+const EmbeddedSource = "embedded"
+
 // ServiceRegistry holds configurations for service validation
 type ServiceRegistry map[string]*kh.KeyHack
 
@@ -16,11 +24,131 @@ var registry = make(ServiceRegistry)
 
 // LoadFromBytes loads configuration from the provided bytes
 func LoadFromBytes(configData []byte) error {
-	if err := yaml.Unmarshal(configData, &registry); err != nil {
-		return fmt.Errorf("failed to parse config: %w", err)
+	_, err := load(configData, EmbeddedSource, true)
+	return err
+}
+
+// LoadFile layers the configuration in the file at path over what has
+// already been loaded. Services that already exist are overridden field by
+// field, and the fields of their request one by one; every other value the
+// layer sets, such as the validator or the headers, replaces the previous one
+// as a whole. New services extend the registry.
+func LoadFile(path string) error {
+	_, err := loadFile(path, true)
+	return err
+}
+
+// AddFile is LoadFile for files that aren't trusted to change the services
+// already loaded: only the new services it defines are added. The names of
+// the services it would have overridden are returned, sorted.
+func AddFile(path string) ([]string, error) {
+	return loadFile(path, false)
+}
+
+// loadFile reads the file at path and loads it as a layer
+func loadFile(path string, override bool) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
 	}
 
-	return nil
+	skipped, err := load(data, path, override)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return skipped, nil
+}
+
+// load merges a configuration layer into the registry, recording source as
+// the origin of every service it touches. Unless override is set, services
+// that already exist are left alone, and their names returned.
+func load(configData []byte, source string, override bool) ([]string, error) {
+	var layer map[string]yaml.Node
+	if err := yaml.Unmarshal(configData, &layer); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	var skipped []string
+	for name, node := range layer {
+		if node.Tag == "!!null" {
+			return nil, fmt.Errorf("service %q has no definition", name)
+		}
+		if _, exists := registry[name]; exists && !override {
+			skipped = append(skipped, name)
+			continue
+		}
+
+		// Decode into a fresh service, as decoding over an existing one would
+		// merge maps and keep pointers, leaving no way to drop a value
+		update := &kh.KeyHack{}
+		if err := node.Decode(update); err != nil {
+			return nil, fmt.Errorf("failed to parse service %q: %w", name, err)
+		}
+
+		service, exists := registry[name]
+		if !exists {
+			service = update
+		} else {
+			overlay(reflect.ValueOf(service).Elem(), reflect.ValueOf(update).Elem(), &node, "request")
+		}
+
+		// The key is what services are looked up by, so make sure the name agrees
+		service.Name = name
+		service.Sources = append(service.Sources, source)
+		registry[name] = service
+	}
+
+	slices.Sort(skipped)
+	return skipped, nil
+}
+
+// overlay copies the fields of src whose keys are set in node, the YAML
+// mapping src was decoded from, over those of dst. The fields named in nested
+// are overlaid the same way rather than replaced.
+func overlay(dst, src reflect.Value, node *yaml.Node, nested ...string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	fields := yamlFields(dst.Type())
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		index, ok := fields[key]
+		if !ok {
+			continue
+		}
+
+		if slices.Contains(nested, key) {
+			overlay(dst.FieldByIndex(index), src.FieldByIndex(index), value)
+			continue
+		}
+		dst.FieldByIndex(index).Set(src.FieldByIndex(index))
+	}
+}
+
+// yamlFields maps the YAML keys of a struct's fields to their index, named
+// as yaml.v3 names them
+func yamlFields(t reflect.Type) map[string][]int {
+	fields := make(map[string][]int, t.NumField())
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || len(f.Index) > 1 {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Index
+	}
+	return fields
 }
 
 // GetService returns a service by name, or nil if not found
@@ -29,6 +157,15 @@ func GetService(name string) (*kh.KeyHack, bool) {
 	return service, exists
 }
 
+// Services returns every configured service, sorted by name
+func Services() []*kh.KeyHack {
+	services := make([]*kh.KeyHack, 0, len(registry))
+	for _, name := range slices.Sorted(maps.Keys(registry)) {
+		services = append(services, registry[name])
+	}
+	return services
+}
+
 // RegisterValidator registers a custom validator for a service
 func RegisterValidator(serviceName string, validator kh.ValidatorFunc) error {
 	service, exists := registry[serviceName]
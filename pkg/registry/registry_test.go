@@ -2,8 +2,11 @@ package registry
 
 import (
 	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/audibleblink/kh/pkg/keyhack"
 )
@@ -268,4 +271,305 @@ github-token:
 	if service.Status != 200 {
 		t.Errorf("Validator Status = %d, want 200", service.Status)
 	}
-}
\ No newline at end of file
+}
+func TestValidatorYAMLParsing(t *testing.T) {
+	clearRegistry()
+
+	yamlData := []byte(`
+slack-token:
+  name: slack-token
+  request:
+    method: POST
+    url: 'https://slack.com/api/auth.test?token=%s'
+  validator:
+    statuses: [200, 204]
+    required_headers:
+      X-OAuth-Scopes: ''
+    forbidden_headers: [X-Error]
+    body_regex: '"ok"'
+    json:
+      ok: true
+    match: any
+`)
+
+	if err := LoadFromBytes(yamlData); err != nil {
+		t.Fatalf("LoadFromBytes() failed with error: %v", err)
+	}
+
+	service, exists := GetService("slack-token")
+	if !exists {
+		t.Fatalf("Service 'slack-token' not found after loading YAML")
+	}
+
+	v := service.Validator
+	if !reflect.DeepEqual(v.Statuses, []int{200, 204}) {
+		t.Errorf("Validator Statuses = %v, want [200 204]", v.Statuses)
+	}
+	if _, ok := v.RequiredHeaders["X-OAuth-Scopes"]; !ok {
+		t.Errorf("Validator RequiredHeaders = %v, want X-OAuth-Scopes", v.RequiredHeaders)
+	}
+	if !reflect.DeepEqual(v.ForbiddenHeaders, []string{"X-Error"}) {
+		t.Errorf("Validator ForbiddenHeaders = %v, want [X-Error]", v.ForbiddenHeaders)
+	}
+	if v.BodyRegex != `"ok"` {
+		t.Errorf("Validator BodyRegex = %q, want %q", v.BodyRegex, `"ok"`)
+	}
+	if v.JSON["ok"] != true {
+		t.Errorf("Validator JSON = %v, want ok: true", v.JSON)
+	}
+	if v.Match != "any" {
+		t.Errorf("Validator Match = %q, want 'any'", v.Match)
+	}
+}
+
+func TestServices(t *testing.T) {
+	clearRegistry()
+
+	yamlData := []byte(`
+slack-token:
+  description: Checks a token against the Slack API
+  request:
+    method: POST
+    url: 'https://slack.com/api/auth.test?token=%s'
+discord:
+  name: not-discord
+  token: '<token>'
+  request:
+    method: GET
+    url: 'https://discordapp.com/api/users/@me'
+`)
+
+	if err := LoadFromBytes(yamlData); err != nil {
+		t.Fatalf("LoadFromBytes() failed with error: %v", err)
+	}
+
+	services := Services()
+	if len(services) != 2 {
+		t.Fatalf("Services() returned %d services, want 2", len(services))
+	}
+
+	// Sorted by name, and names always match the YAML keys
+	if services[0].Name != "discord" || services[1].Name != "slack-token" {
+		t.Errorf("Services() names = [%s %s], want [discord slack-token]", services[0].Name, services[1].Name)
+	}
+
+	if services[0].Placeholder != "<token>" {
+		t.Errorf("Placeholder = %q, want '<token>'", services[0].Placeholder)
+	}
+
+	if services[1].Description != "Checks a token against the Slack API" {
+		t.Errorf("Description = %q, want 'Checks a token against the Slack API'", services[1].Description)
+	}
+}
+
+func TestLoadFileLayering(t *testing.T) {
+	clearRegistry()
+
+	base := []byte(`
+slack-token:
+  description: Checks a token against the Slack API
+  request:
+    method: POST
+    url: 'https://slack.com/api/auth.test?token=%s'
+    headers:
+      Accept: application/json
+`)
+	if err := LoadFromBytes(base); err != nil {
+		t.Fatalf("LoadFromBytes() failed with error: %v", err)
+	}
+
+	layer := filepath.Join(t.TempDir(), "private.yml")
+	err := os.WriteFile(layer, []byte(`
+slack-token:
+  request:
+    headers:
+      X-Extra: "yes"
+internal-api:
+  request:
+    method: GET
+    url: 'https://internal.example/api/me'
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadFile(layer); err != nil {
+		t.Fatalf("LoadFile() failed with error: %v", err)
+	}
+
+	// Existing services are overridden field by field
+	slack, _ := GetService("slack-token")
+	if slack.Method != "POST" || slack.Description != "Checks a token against the Slack API" {
+		t.Errorf("LoadFile() lost fields of the overridden service: %+v", slack)
+	}
+	if !reflect.DeepEqual(slack.Headers, map[string]string{"X-Extra": "yes"}) {
+		t.Errorf("LoadFile() headers = %v, want those of the layer only", slack.Headers)
+	}
+	if !reflect.DeepEqual(slack.Sources, []string{EmbeddedSource, layer}) {
+		t.Errorf("Sources = %v, want [%s %s]", slack.Sources, EmbeddedSource, layer)
+	}
+
+	// New services extend the registry
+	internal, exists := GetService("internal-api")
+	if !exists {
+		t.Fatalf("LoadFile() did not add new service")
+	}
+	if !reflect.DeepEqual(internal.Sources, []string{layer}) {
+		t.Errorf("Sources = %v, want [%s]", internal.Sources, layer)
+	}
+
+	if err := LoadFile(filepath.Join(t.TempDir(), "missing.yml")); err == nil {
+		t.Error("LoadFile() with a missing file should error")
+	}
+
+	// Untrusted files may only add services
+	err = os.WriteFile(layer, []byte(`
+slack-token:
+  request:
+    url: 'https://evil.example/'
+untrusted-api:
+  request:
+    method: GET
+    url: 'https://untrusted.example/'
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped, err := AddFile(layer)
+	if err != nil || !reflect.DeepEqual(skipped, []string{"slack-token"}) {
+		t.Errorf("AddFile() = %v, %v, want slack-token skipped", skipped, err)
+	}
+	if slack, _ := GetService("slack-token"); slack.URL != "https://slack.com/api/auth.test?token=%s" {
+		t.Errorf("AddFile() overrode the URL: %q", slack.URL)
+	}
+	if _, exists := GetService("untrusted-api"); !exists {
+		t.Error("AddFile() did not add new service")
+	}
+
+	// Bodies, validators and extract blocks are replaced, never merged
+	err = LoadFromBytes([]byte(`
+twitter:
+  request:
+    method: POST
+    url: 'https://api.twitter.com/oauth2/token'
+    body:
+      form:
+        grant_type: client_credentials
+  validator:
+    json:
+      ok: true
+  extract:
+    team: {json: team}
+    user: {json: user}
+`))
+	if err != nil {
+		t.Fatalf("LoadFromBytes() failed with error: %v", err)
+	}
+	err = os.WriteFile(layer, []byte(`
+twitter:
+  request:
+    body:
+      json:
+        grant_type: client_credentials
+  validator:
+    status: 200
+  extract:
+    team: {json: team.name}
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadFile(layer); err != nil {
+		t.Fatalf("LoadFile() failed with error: %v", err)
+	}
+
+	twitter, _ := GetService("twitter")
+	if twitter.Method != "POST" || twitter.URL != "https://api.twitter.com/oauth2/token" {
+		t.Errorf("LoadFile() lost request fields: %+v", twitter.Request)
+	}
+	if twitter.Body.Form != nil || twitter.Body.JSON == nil {
+		t.Errorf("LoadFile() body = %+v, want the JSON body only", twitter.Body)
+	}
+	if twitter.Validator.JSON != nil || twitter.Validator.Status != 200 {
+		t.Errorf("LoadFile() validator = %+v, want status 200 only", twitter.Validator)
+	}
+	if want := map[string]keyhack.Extractor{"team": {JSON: "team.name"}}; !reflect.DeepEqual(twitter.Extract, want) {
+		t.Errorf("LoadFile() extract = %v, want %v", twitter.Extract, want)
+	}
+}
+
+func TestTimeoutYAMLParsing(t *testing.T) {
+	clearRegistry()
+
+	if err := LoadFromBytes([]byte("slow:\n  timeout: 30s\n")); err != nil {
+		t.Fatalf("LoadFromBytes() failed with error: %v", err)
+	}
+
+	service, _ := GetService("slow")
+	if service.Timeout != 30*time.Second {
+		t.Errorf("Timeout = %v, want 30s", service.Timeout)
+	}
+}
+
+func TestExtractYAMLParsing(t *testing.T) {
+	clearRegistry()
+
+	yamlData := `
+github-token:
+  extract:
+    login: {json: $.login}
+    scopes: {header: X-OAuth-Scopes}
+    plan: {regex: 'plan=(\w+)'}
+`
+	if err := LoadFromBytes([]byte(yamlData)); err != nil {
+		t.Fatalf("LoadFromBytes() failed with error: %v", err)
+	}
+
+	service, _ := GetService("github-token")
+	want := map[string]keyhack.Extractor{
+		"login":  {JSON: "$.login"},
+		"scopes": {Header: "X-OAuth-Scopes"},
+		"plan":   {Regex: `plan=(\w+)`},
+	}
+	if !reflect.DeepEqual(service.Extract, want) {
+		t.Errorf("Extract = %+v, want %+v", service.Extract, want)
+	}
+}
+
+func TestDetectionYAMLParsing(t *testing.T) {
+	clearRegistry()
+
+	yamlData := `
+github-token:
+  pattern: 'gh[pousr]_[A-Za-z0-9]{36}'
+  prefixes: [ghp_, gho_]
+`
+	if err := LoadFromBytes([]byte(yamlData)); err != nil {
+		t.Fatalf("LoadFromBytes() failed with error: %v", err)
+	}
+
+	service, _ := GetService("github-token")
+	if service.Pattern != `gh[pousr]_[A-Za-z0-9]{36}` || !reflect.DeepEqual(service.Prefixes, []string{"ghp_", "gho_"}) {
+		t.Errorf("Pattern = %q, Prefixes = %q", service.Pattern, service.Prefixes)
+	}
+}
+
+func TestRulesYAMLParsing(t *testing.T) {
+	clearRegistry()
+
+	yamlData := `
+github-token:
+  rules:
+    gitleaks: [github-pat, github-oauth]
+    trufflehog: [Github]
+`
+	if err := LoadFromBytes([]byte(yamlData)); err != nil {
+		t.Fatalf("LoadFromBytes() failed with error: %v", err)
+	}
+
+	service, _ := GetService("github-token")
+	want := map[string][]string{"gitleaks": {"github-pat", "github-oauth"}, "trufflehog": {"Github"}}
+	if !reflect.DeepEqual(service.Rules, want) {
+		t.Errorf("Rules = %v, want %v", service.Rules, want)
+	}
+}